@@ -0,0 +1,300 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/store"
+	"github.com/aoaostar/mooc/pkg/task"
+)
+
+const usage = `英华学堂网课助手
+
+用法:
+  mooc [serve] [参数]              启动Web服务, 通过网页控制执行任务 (默认)
+  mooc run [参数]                  不启动Web服务直接刷课, 有课程失败时退出码非0
+                                  -dry-run 只输出运行计划, 不学习任何节点
+  mooc courses list [--user 用户]  列出用户的在学课程
+  mooc config validate [参数]      校验配置文件
+  mooc status [参数]               查看运行日志中的最近运行
+  mooc vault migrate [参数]        加密配置文件中的明文密码
+
+通用参数:
+  -config string   配置文件路径, 支持 .json .yaml .yml .toml
+                   (默认读取环境变量 MOOC_CONFIG, 否则依次查找当前目录下的 config.json/yaml/yml/toml)
+  -log-dir string  日志目录 (默认 "./logs")
+  -listen string   Web服务监听地址, 仅 serve 有效, 覆盖配置中的 server
+`
+
+// Main 解析命令行并执行子命令, 返回进程退出码
+func Main(args []string) int {
+	command := "serve"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		if !parseFlags("serve", args, nil) {
+			return 2
+		}
+		Run()
+		return 0
+	case "run":
+		var dryRun bool
+		if !parseFlags("run", args, func(fs *flag.FlagSet) {
+			fs.BoolVar(&dryRun, "dry-run", false, "只输出运行计划, 不学习任何节点")
+		}) {
+			return 2
+		}
+		if dryRun {
+			return exit(printPlan(os.Stdout))
+		}
+		return RunOnce()
+	case "courses":
+		if len(args) == 0 || args[0] != "list" {
+			return badUsage("未知的子命令: mooc courses " + first(args))
+		}
+		var username string
+		if !parseFlags("courses list", args[1:], func(fs *flag.FlagSet) {
+			fs.StringVar(&username, "user", "", "用户名, 不填则列出所有用户的课程")
+		}) {
+			return 2
+		}
+		return exit(listCourses(os.Stdout, username))
+	case "config":
+		if len(args) == 0 || args[0] != "validate" {
+			return badUsage("未知的子命令: mooc config " + first(args))
+		}
+		if !parseFlags("config validate", args[1:], nil) {
+			return 2
+		}
+		return exit(validateConfig(os.Stdout))
+	case "status":
+		limit := 10
+		if !parseFlags("status", args, func(fs *flag.FlagSet) {
+			fs.IntVar(&limit, "n", limit, "显示的运行数")
+		}) {
+			return 2
+		}
+		return exit(printStatus(os.Stdout, limit))
+	case "vault":
+		if len(args) == 0 || args[0] != "migrate" {
+			return badUsage("未知的子命令: mooc vault " + first(args))
+		}
+		if !parseFlags("vault migrate", args[1:], nil) {
+			return 2
+		}
+		return VaultMigrate()
+	case "help":
+		fmt.Print(usage)
+		return 0
+	default:
+		return badUsage("未知的命令: " + command)
+	}
+}
+
+// parseFlags 解析子命令参数, extra 用于注册子命令特有的参数
+func parseFlags(name string, args []string, extra func(fs *flag.FlagSet)) bool {
+	fs := flag.NewFlagSet("mooc "+name, flag.ContinueOnError)
+	fs.StringVar(&options.ConfigPath, "config", options.ConfigPath, "配置文件路径")
+	fs.StringVar(&options.LogDir, "log-dir", options.LogDir, "日志目录")
+	fs.StringVar(&options.Listen, "listen", options.Listen, "Web服务监听地址")
+	if extra != nil {
+		extra(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "多余的参数:", fs.Args())
+		return false
+	}
+	return true
+}
+
+func badUsage(message string) int {
+	fmt.Fprintln(os.Stderr, message)
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+func first(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func exit(err error) int {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// listCourses 登录并列出用户的在学课程
+func listCourses(out io.Writer, username string) error {
+	if err := InitConfig(); err != nil {
+		return err
+	}
+
+	var users []config.User
+	for _, user := range config.Get().Users {
+		if username == "" || user.Username == username {
+			users = append(users, user)
+		}
+	}
+	if len(users) == 0 {
+		if username != "" {
+			return errors.New("未找到用户: " + username)
+		}
+		return errors.New("未配置用户")
+	}
+
+	ctx := context.Background()
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "用户\t课程ID\t课程名称\t进度\t状态")
+	var failed error
+	for _, user := range users {
+		driver, err := platform.New(user)
+		if err != nil {
+			failed = fmt.Errorf("用户 %s: %v", user.Username, err)
+			fmt.Fprintln(os.Stderr, failed)
+			continue
+		}
+		if err := driver.Login(ctx); err != nil {
+			failed = fmt.Errorf("用户 %s 登录失败: %v", user.Username, err)
+			fmt.Fprintln(os.Stderr, failed)
+			continue
+		}
+		courses, err := driver.ListCourses(ctx)
+		if err != nil {
+			failed = fmt.Errorf("用户 %s 获取课程列表失败: %v", user.Username, err)
+			fmt.Fprintln(os.Stderr, failed)
+			continue
+		}
+		for _, course := range courses {
+			state := "进行中"
+			if course.Ended {
+				state = "已结束"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", user.Username, course.ID, course.Name, course.ProgressText, state)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return failed
+}
+
+// printPlan 登录并输出所有用户的运行计划, 不上报任何学时
+func printPlan(out io.Writer) error {
+	if err := InitConfig(); err != nil {
+		return err
+	}
+	users := config.Get().Users
+	if len(users) == 0 {
+		return errors.New("未配置用户")
+	}
+
+	plan := task.MakePlan(context.Background(), users)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "用户\t课程ID\t课程名称\t操作\t章节\t节点\t视频(待学)\t手动\t锁定\t剩余视频")
+	var failed error
+	for _, user := range plan.Users {
+		if user.Error != "" {
+			failed = errors.New(user.Error)
+			fmt.Fprintln(os.Stderr, failed)
+			continue
+		}
+		for _, course := range user.Courses {
+			action := "学习"
+			switch {
+			case course.Error != "":
+				action = course.Error
+			case course.Action == task.PlanSkip:
+				action = "跳过: " + course.Reason
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%d\t%d(%d)\t%d\t%d\t%s\n",
+				user.Username, course.CourseID, course.CourseName, action, course.Chapters, course.Nodes,
+				course.VideoNodes, course.PendingNodes, course.ManualNodes, course.LockedNodes, formatDuration(course.Remaining))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "调度策略: %s, 预计学习时间: %s\n", plan.Schedule, formatDuration(plan.Estimate.ETA))
+	return failed
+}
+
+// formatDuration 将秒数格式化为时长
+func formatDuration(seconds int) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// validateConfig 读取并校验配置文件, 逐行输出每个字段的问题
+func validateConfig(out io.Writer) error {
+	if err := InitConfig(); err != nil {
+		var invalid config.ValidationError
+		if !errors.As(err, &invalid) {
+			return err
+		}
+		for _, field := range invalid {
+			fmt.Fprintln(out, field.Error())
+		}
+		return fmt.Errorf("配置文件 %s 存在 %d 个问题", configPath(), len(invalid))
+	}
+	fmt.Fprintf(out, "配置文件有效: %s, 用户数: %d\n", configPath(), len(config.Get().Users))
+	return nil
+}
+
+// printStatus 从运行日志输出最近的运行及其课程状态
+func printStatus(out io.Writer, limit int) error {
+	// 只读载入, 不创建数据目录, 也不与正在运行的服务争用日志文件
+	records, err := store.Load(store.DefaultDir)
+	if err != nil {
+		return errors.New("读取运行日志失败: " + err.Error())
+	}
+	if len(records) == 0 {
+		fmt.Fprintln(out, "暂无运行记录")
+		return nil
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "运行ID\t创建时间\t状态\t用户数\t课程数\t已完成\t失败")
+	for _, rec := range records {
+		state := rec.State
+		if !rec.Finished {
+			// 正在进行或进程意外退出
+			state = "unfinished"
+		}
+		total, done, failed := 0, 0, 0
+		for _, courses := range rec.Courses {
+			for _, status := range courses {
+				total++
+				switch status {
+				case store.CourseDone:
+					done++
+				case store.CourseFailed:
+					failed++
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+			rec.ID, rec.CreatedAt.Format("2006-01-02 15:04:05"), state, len(rec.Users), total, done, failed)
+	}
+	return w.Flush()
+}
@@ -1,30 +1,156 @@
 package bootstrap
 
 import (
-	"encoding/json"
 	"errors"
 	"io"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/aoaostar/mooc/pkg/config"
 )
 
-func InitConfig() error {
+// configMu 串行化配置文件的载入与保存
+var configMu sync.Mutex
+
+// configStamp 最近一次载入或保存后配置文件的状态, 用于判断文件是否被修改
+var configStamp fileStamp
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func (s fileStamp) equal(other fileStamp) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size
+}
+
+// configPath 当前使用的配置文件路径, 由命令行参数、环境变量或默认路径决定
+func configPath() string {
+	return config.ResolvePath(options.ConfigPath)
+}
+
+func statConfig() (fileStamp, error) {
+	info, err := os.Stat(configPath())
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// readConfig 读取配置文件, 按扩展名解析 JSON、YAML 或 TOML
+func readConfig() (config.Config, error) {
+	var conf config.Config
+	path := configPath()
 
-	file, err := os.Open("./config.json")
+	file, err := os.Open(path)
 	if err != nil {
-		return errors.New("读取配置文件失败: " + err.Error())
+		return conf, errors.New("读取配置文件失败: " + err.Error())
 	}
+	defer file.Close()
 	readAll, err := io.ReadAll(file)
 	if err != nil {
-		return err
+		return conf, err
+	}
+
+	if err := config.Unmarshal(readAll, config.FormatOf(path), &conf); err != nil {
+		return conf, errors.New("解析配置文件失败: " + err.Error())
+	}
+	return conf, nil
+}
+
+// loadConfig 读取配置文件, 解析密码、应用环境变量并校验
+// 优先级从高到低: MOOC_* 环境变量 > password_env > password_file > 配置文件
+func loadConfig() (config.Config, error) {
+	conf, err := readConfig()
+	if err != nil {
+		return conf, err
+	}
+
+	// 解密以密文保存的用户密码
+	if err := decryptPasswords(&conf); err != nil {
+		return conf, err
+	}
+	if err := overrideConfig(&conf); err != nil {
+		return conf, err
+	}
+	// 校验并填充默认值
+	if err := conf.Validate(); err != nil {
+		return conf, err
+	}
+	if err := validatePlatforms(conf); err != nil {
+		return conf, err
 	}
+	return conf, nil
+}
 
-	err = json.Unmarshal(readAll, &config.Conf)
+// overrideConfig 读取 password_env 与 password_file 并应用环境变量, 合并报告全部问题
+func overrideConfig(conf *config.Config) error {
+	var errs config.ValidationError
+	for _, err := range []error{conf.ResolvePasswords(), conf.ApplyEnv()} {
+		var invalid config.ValidationError
+		if errors.As(err, &invalid) {
+			errs = append(errs, invalid...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func InitConfig() error {
+	configMu.Lock()
+	defer configMu.Unlock()
 
+	stamp, _ := statConfig()
+	conf, err := loadConfig()
 	if err != nil {
 		return err
 	}
+	config.Set(conf)
+	configStamp = stamp
 	return nil
 
 }
+
+// SaveConfig 校验配置后按读取时的格式保存到文件并更新内存中的配置
+// 校验失败时返回 config.ValidationError, 不写入文件
+func SaveConfig(conf config.Config) error {
+	// 环境变量始终优先于网页提交的配置
+	if err := conf.ApplyEnv(); err != nil {
+		return err
+	}
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	if err := validatePlatforms(conf); err != nil {
+		return err
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	// 来自环境变量与密码文件的值不写入配置文件, 保留文件中的原值
+	file, _ := readConfig()
+	stored, err := encryptPasswords(conf.Persistable(file))
+	if err != nil {
+		return errors.New("加密密码失败: " + err.Error())
+	}
+	path := configPath()
+	configData, err := config.Marshal(stored, config.FormatOf(path))
+	if err != nil {
+		return errors.New("配置序列化失败")
+	}
+
+	if err := os.WriteFile(path, configData, 0644); err != nil {
+		return errors.New("保存配置文件失败")
+	}
+
+	config.Set(conf)
+	// 自己写入的修改不需要重新载入
+	configStamp, _ = statConfig()
+	return nil
+}
@@ -0,0 +1,65 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoaostar/mooc/pkg/config"
+)
+
+// writeConfig 写入临时配置文件并使用它
+func writeConfig(t *testing.T, conf config.Config) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	data, err := config.Marshal(conf, config.FormatOf(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	previous := options.ConfigPath
+	options.ConfigPath = path
+	t.Cleanup(func() { options.ConfigPath = previous })
+	return path
+}
+
+func TestSaveConfigKeepsEnvUserOverrides(t *testing.T) {
+	users := []config.User{
+		{BaseURL: "https://example.com/", Username: "alice", Password: "secret"},
+		{BaseURL: "https://example.com/", Username: "carol", Password: "hunter2"},
+	}
+	path := writeConfig(t, config.Config{Global: config.Global{Limit: 3}, Users: users})
+	t.Setenv("MOOC_USERS_0_USERNAME", "bob")
+	t.Setenv("MOOC_USERS_1_PASSWORD", "from-env")
+
+	if err := InitConfig(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := config.Get()
+	if loaded.Users[0].Username != "bob" || loaded.Users[1].Password != "from-env" {
+		t.Fatalf("载入的用户 = %+v, 期望应用环境变量", loaded.Users)
+	}
+	if err := SaveConfig(loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved config.Config
+	if err := config.Unmarshal(data, config.FormatOf(path), &saved); err != nil {
+		t.Fatal(err)
+	}
+	for i := range saved.Users {
+		got, want := saved.Users[i], users[i]
+		if got.Username != want.Username || got.Password != want.Password {
+			t.Errorf("保存的 users[%d] = %s/%s, 期望 %s/%s", i, got.Username, got.Password, want.Username, want.Password)
+		}
+	}
+	if len(saved.Users) != len(users) {
+		t.Errorf("保存的用户数 = %d, 期望 %d", len(saved.Users), len(users))
+	}
+}
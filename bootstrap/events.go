@@ -0,0 +1,67 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/hub"
+	"github.com/sirupsen/logrus"
+)
+
+// 进程内事件中心, 日志与任务引擎都向其发布消息, 保留最近100行日志
+var events = hub.New(100)
+
+// handleEvents 以 Server-Sent Events 推送日志、运行状态与进度更新
+func handleEvents(writer http.ResponseWriter, request *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "不支持流式响应", http.StatusInternalServerError)
+		return
+	}
+
+	// 订阅与最近日志的快照同时获取, 回放的日志既不重复也不遗漏
+	logs, messages, unsubscribe := events.SubscribeWithLogs()
+	defer unsubscribe()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.Header().Set("X-Accel-Buffering", "no")
+
+	for _, msg := range logs {
+		writeEvent(writer, msg)
+	}
+	if run := runs.Latest(); run != nil {
+		writeEvent(writer, hub.Message{Type: hub.TypeRun, Time: time.Now(), Data: run.Info()})
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			writeEvent(writer, msg)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(writer, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(writer http.ResponseWriter, msg hub.Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logrus.Error("序列化事件失败: ", err)
+		return
+	}
+	fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", msg.Type, data)
+}
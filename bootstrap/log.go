@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"time"
 
+	"github.com/aoaostar/mooc/pkg/hub"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
@@ -96,7 +97,7 @@ func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 
 func InitLog() {
 	// 创建日志目录
-	logDir := "./logs"
+	logDir := options.LogDir
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
 		os.MkdirAll(logDir, 0755)
 	}
@@ -124,5 +125,8 @@ func InitLog() {
 	// 禁用调用者信息
 	logrus.SetReportCaller(false)
 
+	// 推送日志到事件中心, 供网页实时展示
+	logrus.AddHook(hub.NewLogHook(events))
+
 	logrus.Info("日志系统初始化成功")
 }
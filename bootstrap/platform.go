@@ -0,0 +1,29 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+
+	// 注册内置平台驱动
+	_ "github.com/aoaostar/mooc/pkg/yinghua"
+)
+
+// validatePlatforms 检查用户配置的平台是否已注册
+func validatePlatforms(conf config.Config) error {
+	var errs config.ValidationError
+	for i, user := range conf.Users {
+		if !platform.Registered(user.Platform) {
+			errs = append(errs, config.FieldError{
+				Field:   fmt.Sprintf("users[%d].platform", i),
+				Message: fmt.Sprintf("不支持的平台 %s, 可选: %s", user.Platform, strings.Join(platform.Names(), ", ")),
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
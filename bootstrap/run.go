@@ -1,15 +1,32 @@
 package bootstrap
 
 import (
-	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/aoaostar/mooc/pkg/config"
 	"github.com/aoaostar/mooc/pkg/task"
 	"github.com/aoaostar/mooc/pkg/util"
-	"github.com/aoaostar/mooc/pkg/yinghua"
-	"github.com/aoaostar/mooc/pkg/yinghua/types"
 	"github.com/sirupsen/logrus"
 )
 
+// Options 命令行通用参数
+type Options struct {
+	// ConfigPath 配置文件路径, 为空时见 config.ResolvePath
+	ConfigPath string
+	// LogDir 日志目录
+	LogDir string
+	// Listen Web服务监听地址, 为空时使用配置中的 server
+	Listen string
+}
+
+var options = Options{
+	LogDir: "./logs",
+}
+
+// Run 启动Web服务并进入待机状态, 通过网页控制执行任务
 func Run() {
 
 	InitLog()
@@ -22,6 +39,17 @@ func Run() {
 		logrus.Fatal(err)
 	}
 
+	// 手动修改配置文件后无需重启
+	WatchConfig(2 * time.Second)
+
+	err = InitStore()
+
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	ResumeRun()
+
 	// 启动Web服务
 	InitWeb()
 
@@ -30,117 +58,58 @@ func Run() {
 	// 阻塞主线程，保持程序运行
 	select {}
 }
-// send 处理单个用户的课程任务
-func send(user config.User) {
-
-	instance := yinghua.New(user)
 
-	err := instance.Login()
-	if err != nil {
-		logrus.Error(fmt.Sprintf("用户 %s 登录失败: %v", user.Username, err))
-		return
-	}
-	instance.Output("登录成功")
+// RunOnce 不启动Web服务, 处理所有用户的课程任务后返回进程退出码
+// 有课程失败或运行被中断时返回非0
+func RunOnce() int {
 
-	err = instance.GetCourses()
-	if err != nil {
-		logrus.Error(fmt.Sprintf("用户 %s 获取课程列表失败: %v", user.Username, err))
-		return
-	}
+	InitLog()
 
-	instance.Output(fmt.Sprintf("获取全部在学课程成功, 共计 %d 门\n", len(instance.Courses)))
-
-	// 清空之前的任务列表
-	task.Tasks = []task.Task{}
-
-	// 检查是否指定了课程名称
-	if len(user.CourseNames) > 0 {
-		// 根据课程名称筛选课程
-		var selectedCourses []types.CoursesList
-		for _, name := range user.CourseNames {
-			courses, err := instance.GetCourseByName(name)
-			if err != nil {
-				logrus.Error(fmt.Sprintf("查找课程 '%s' 失败: %v", name, err))
-				continue
-			}
-
-			if len(courses) == 0 {
-				logrus.Warn(fmt.Sprintf("未找到课程: '%s'", name))
-			} else {
-				selectedCourses = append(selectedCourses, courses...)
-				instance.Output(fmt.Sprintf("找到课程: '%s', 共 %d 个匹配结果", name, len(courses)))
-			}
-		}
+	util.Copyright()
 
-		// 添加筛选后的课程到任务列表
-		for _, course := range selectedCourses {
-			task.Tasks = append(task.Tasks, task.Task{
-				User:   user,
-				Course: course,
-				Status: false,
-			})
-		}
-	} else {
-		// 如果没有指定课程名称，则添加所有课程
-		for _, course := range instance.Courses {
-			task.Tasks = append(task.Tasks, task.Task{
-				User:   user,
-				Course: course,
-				Status: false,
-			})
-		}
+	if err := InitConfig(); err != nil {
+		logrus.Error(err)
+		return 1
 	}
 
-	// 如果任务列表不为空，启动任务处理
-	if len(task.Tasks) > 0 {
-		task.Start()
-	} else {
-		logrus.Warn("没有找到可添加的任务")
+	if err := InitStore(); err != nil {
+		logrus.Error(err)
+		return 1
 	}
-	instance.Output("登录成功")
 
-	err = instance.GetCourses()
+	users := config.Get().Users
+	var usernames []string
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	run, err := runs.StartRun(usernames)
 	if err != nil {
-		logrus.Fatal(err)
+		logrus.Error(err)
+		return 1
 	}
 
-	instance.Output(fmt.Sprintf("获取全部在学课程成功, 共计 %d 门\n", len(instance.Courses)))
-
-	// 检查是否指定了课程名称
-	if len(user.CourseNames) > 0 {
-		// 根据课程名称筛选课程
-		var selectedCourses []types.CoursesList
-		for _, name := range user.CourseNames {
-			courses, err := instance.GetCourseByName(name)
-			if err != nil {
-				logrus.Error(fmt.Sprintf("查找课程 '%s' 失败: %v", name, err))
-				continue
-			}
-
-			if len(courses) == 0 {
-				logrus.Warn(fmt.Sprintf("未找到课程: '%s'", name))
-			} else {
-				selectedCourses = append(selectedCourses, courses...)
-				instance.Output(fmt.Sprintf("找到课程: '%s', 共 %d 个匹配结果", name, len(courses)))
-			}
+	// 收到中断信号时取消运行, 已学习的进度会保存到运行日志
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			logrus.Warn("收到中断信号, 正在取消运行")
+			_ = runs.Cancel(run.ID)
+		case <-run.Context().Done():
 		}
+	}()
 
-		// 添加筛选后的课程到任务列表
-		for _, course := range selectedCourses {
-			task.Tasks = append(task.Tasks, task.Task{
-				User:   user,
-				Course: course,
-				Status: false,
-			})
-		}
-	} else {
-		// 如果没有指定课程名称，则添加所有课程
-		for _, course := range instance.Courses {
-			task.Tasks = append(task.Tasks, task.Task{
-				User:   user,
-				Course: course,
-				Status: false,
-			})
-		}
+	run.Execute(users)
+	run.Finish()
+
+	if run.State() == task.RunCanceled {
+		return 1
+	}
+	if failed := run.Failed(); failed > 0 {
+		logrus.Errorf("运行[%s]结束, 失败 %d 项", run.ID, failed)
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,53 @@
+package bootstrap
+
+import (
+	"errors"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/store"
+	"github.com/aoaostar/mooc/pkg/task"
+	"github.com/sirupsen/logrus"
+)
+
+// InitStore 打开本地运行日志并创建运行管理器
+func InitStore() error {
+	journal, err := store.Open(store.DefaultDir)
+	if err != nil {
+		return errors.New("打开运行日志失败: " + err.Error())
+	}
+	runs = task.NewManager(journal, events)
+	return nil
+}
+
+// ResumeRun 根据配置恢复上次进程退出时未结束的运行
+func ResumeRun() {
+	conf := config.Get()
+	if !conf.Global.Resume {
+		return
+	}
+	run, err := runs.Resume()
+	if err != nil {
+		logrus.Error("恢复运行失败: ", err)
+		return
+	}
+	if run == nil {
+		return
+	}
+
+	// 仅恢复仍在配置中的用户
+	var users []config.User
+	for _, username := range run.Users {
+		for _, user := range conf.Users {
+			if user.Username == username {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+	logrus.Infof("恢复上次未完成的运行[%s], 用户数: %d", run.ID, len(users))
+
+	go func() {
+		defer run.Finish()
+		run.Execute(users)
+	}()
+}
@@ -0,0 +1,102 @@
+package bootstrap
+
+import (
+	"errors"
+	"os"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/vault"
+	"github.com/sirupsen/logrus"
+)
+
+// 凭据库, 配置文件中存在加密密码或执行过迁移时启用, 启用后保存配置时自动加密密码
+var credentials *vault.Vault
+
+// decryptPasswords 解密配置中的用户密码, 内存中始终保存明文
+func decryptPasswords(conf *config.Config) error {
+	encrypted := false
+	for _, user := range conf.Users {
+		if vault.IsEncrypted(user.Password) {
+			encrypted = true
+			break
+		}
+	}
+	if !encrypted {
+		return nil
+	}
+
+	if credentials == nil {
+		v, err := vault.Open(vault.DefaultKeyFile, false)
+		if err != nil {
+			return err
+		}
+		credentials = v
+	}
+	for i, user := range conf.Users {
+		password, err := credentials.Decrypt(user.Password)
+		if err != nil {
+			return errors.New("用户 " + user.Username + ": " + err.Error())
+		}
+		conf.Users[i].Password = password
+	}
+	return nil
+}
+
+// encryptPasswords 返回用户密码已加密的配置副本, 未启用凭据库时原样返回
+func encryptPasswords(conf config.Config) (config.Config, error) {
+	if credentials == nil {
+		return conf, nil
+	}
+	users := make([]config.User, len(conf.Users))
+	for i, user := range conf.Users {
+		if user.Password != "" {
+			password, err := credentials.Encrypt(user.Password)
+			if err != nil {
+				return conf, err
+			}
+			user.Password = password
+		}
+		users[i] = user
+	}
+	conf.Users = users
+	return conf, nil
+}
+
+// VaultMigrate 将配置文件中的明文密码加密保存, 返回进程退出码
+func VaultMigrate() int {
+	v, err := vault.Open(vault.DefaultKeyFile, true)
+	if err != nil {
+		logrus.Error(err)
+		return 1
+	}
+	credentials = v
+
+	file, err := readConfig()
+	if err != nil {
+		logrus.Error(err)
+		return 1
+	}
+	count := 0
+	for _, user := range file.Users {
+		if user.Password != "" && !vault.IsEncrypted(user.Password) {
+			count++
+		}
+	}
+
+	conf, err := loadConfig()
+	if err != nil {
+		logrus.Error(err)
+		return 1
+	}
+	if err := SaveConfig(conf); err != nil {
+		logrus.Error(err)
+		return 1
+	}
+
+	if os.Getenv(vault.PassphraseEnv) != "" {
+		logrus.Infof("已使用主密码加密 %d 个用户密码, 启动时请设置环境变量 %s", count, vault.PassphraseEnv)
+	} else {
+		logrus.Infof("已使用密钥文件 %s 加密 %d 个用户密码, 请妥善保管该文件", vault.DefaultKeyFile, count)
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package bootstrap
+
+import (
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+// WatchConfig 定期检查配置文件, 被修改后重新载入并校验
+// 新配置只影响之后开始的运行, 正在进行的运行继续使用开始时的配置
+func WatchConfig(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reloadConfig()
+		}
+	}()
+}
+
+// reloadConfig 配置文件有变化时重新载入, 载入失败时保留当前配置
+func reloadConfig() {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	stamp, err := statConfig()
+	if err != nil || stamp.equal(configStamp) {
+		// 编辑器保存时文件可能短暂不存在, 下次检查再处理
+		return
+	}
+	// 记录本次状态, 文件再次修改前不重复报告同一个错误
+	configStamp = stamp
+
+	old := config.Get()
+	conf, err := loadConfig()
+	if err != nil {
+		logrus.Warn("配置文件已修改但载入失败, 继续使用当前配置: ", err)
+		return
+	}
+	config.Set(conf)
+
+	logrus.Infof("配置文件已重新载入, 用户数: %d, 协程数: %d, 将在下次运行时生效", len(conf.Users), conf.Global.Limit)
+	if conf.Global.Server != old.Global.Server && options.Listen == "" {
+		logrus.Warn("监听地址修改需要重启程序后生效")
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"os"
+
 	"github.com/aoaostar/mooc/bootstrap"
 )
 
 func main() {
-	bootstrap.Run()
+	os.Exit(bootstrap.Main(os.Args[1:]))
 }
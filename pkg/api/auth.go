@@ -0,0 +1,178 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+)
+
+// SessionCookie 登录会话的 Cookie 名称
+const SessionCookie = "mooc_session"
+
+const sessionTTL = 7 * 24 * time.Hour
+
+// CodeUnauthorized 未认证错误码
+const CodeUnauthorized = "unauthorized"
+
+// Auth 网页控制台认证, 支持管理员密码登录的会话 Cookie 与 Bearer Token
+// 配置中的 admin_password 与 token 均为空时不启用认证
+type Auth struct {
+	mu       sync.Mutex
+	sessions map[string]time.Time
+	// LoginPath 未登录访问页面时跳转的地址
+	LoginPath string
+	// Public 无需认证即可访问的路径
+	Public []string
+}
+
+func NewAuth(loginPath string, public ...string) *Auth {
+	return &Auth{
+		sessions:  make(map[string]time.Time),
+		LoginPath: loginPath,
+		Public:    append([]string{loginPath}, public...),
+	}
+}
+
+// IsAdmin 请求是否携带有效的会话或令牌, 未启用认证时始终为 false
+func (a *Auth) IsAdmin(request *http.Request) bool {
+	global := config.Get().Global
+	if !global.AuthEnabled() {
+		return false
+	}
+
+	if global.Token != "" {
+		header := request.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") && equal(strings.TrimPrefix(header, "Bearer "), global.Token) {
+			return true
+		}
+	}
+
+	if global.AdminPassword != "" {
+		if cookie, err := request.Cookie(SessionCookie); err == nil {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			expires, ok := a.sessions[cookie.Value]
+			if ok && time.Now().Before(expires) {
+				return true
+			}
+			delete(a.sessions, cookie.Value)
+		}
+	}
+	return false
+}
+
+// Middleware 拦截未认证的请求: 页面跳转到登录页, 接口返回401
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !config.Get().Global.AuthEnabled() || a.isPublic(request.URL.Path) || a.IsAdmin(request) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		path := request.URL.Path
+		switch {
+		case strings.HasPrefix(path, Prefix+"/"):
+			writeError(writer, http.StatusUnauthorized, CodeUnauthorized, "未登录或令牌无效")
+		case request.Method == http.MethodGet && (path == "/" || strings.HasSuffix(path, ".html")):
+			http.Redirect(writer, request, a.LoginPath, http.StatusFound)
+		default:
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(writer).Encode(map[string]string{"error": "未登录或令牌无效"})
+		}
+	})
+}
+
+// HandleLogin 校验管理员密码并下发会话 Cookie, 支持 JSON 与表单提交
+func (a *Auth) HandleLogin(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "不支持的请求方法: "+request.Method)
+		return
+	}
+
+	var password string
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			writeError(writer, http.StatusBadRequest, CodeBadRequest, "无效的请求格式")
+			return
+		}
+		password = body.Password
+	} else {
+		password = request.FormValue("password")
+	}
+
+	adminPassword := config.Get().Global.AdminPassword
+	if adminPassword == "" || !equal(password, adminPassword) {
+		writeError(writer, http.StatusUnauthorized, CodeUnauthorized, "密码错误")
+		return
+	}
+
+	token, err := newSessionID()
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, CodeInternal, "创建会话失败")
+		return
+	}
+	expires := time.Now().Add(sessionTTL)
+	a.mu.Lock()
+	a.sessions[token] = expires
+	a.mu.Unlock()
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeData(writer, http.StatusOK, map[string]string{"expires": expires.Format(time.RFC3339)})
+}
+
+// HandleLogout 注销当前会话
+func (a *Auth) HandleLogout(writer http.ResponseWriter, request *http.Request) {
+	if cookie, err := request.Cookie(SessionCookie); err == nil {
+		a.mu.Lock()
+		delete(a.sessions, cookie.Value)
+		a.mu.Unlock()
+	}
+	http.SetCookie(writer, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	http.Redirect(writer, request, a.LoginPath, http.StatusFound)
+}
+
+func (a *Auth) isPublic(path string) bool {
+	for _, p := range a.Public {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+// 错误码
+const (
+	CodeBadRequest       = "bad_request"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeInvalidConfig    = "invalid_config"
+	CodeUpstream         = "upstream_error"
+	CodeInternal         = "internal_error"
+)
+
+// Error 错误信息
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields 配置校验失败时每个字段的错误
+	Fields []config.FieldError `json:"fields,omitempty"`
+}
+
+// Envelope 统一响应结构, 成功时 error 为空, 失败时 data 为空
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Error *Error      `json:"error"`
+}
+
+func writeJSON(writer http.ResponseWriter, status int, body Envelope) {
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(body); err != nil {
+		logrus.Error("写入响应失败: ", err)
+	}
+}
+
+func writeData(writer http.ResponseWriter, status int, data interface{}) {
+	writeJSON(writer, status, Envelope{Data: data})
+}
+
+func writeError(writer http.ResponseWriter, status int, code string, message string) {
+	writeJSON(writer, status, Envelope{Error: &Error{Code: code, Message: message}})
+}
+
+func writeFieldErrors(writer http.ResponseWriter, err config.ValidationError) {
+	writeJSON(writer, http.StatusBadRequest, Envelope{Error: &Error{Code: CodeInvalidConfig, Message: err.Error(), Fields: err}})
+}
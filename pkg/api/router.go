@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Params 路径参数, 如 /runs/{id} 中的 id
+type Params map[string]string
+
+// HandlerFunc 带路径参数的处理函数
+type HandlerFunc func(writer http.ResponseWriter, request *http.Request, params Params)
+
+type route struct {
+	method   string
+	segments []string
+	handler  HandlerFunc
+}
+
+// Router 按方法和路径段匹配的简单路由, 路径匹配但方法不符时返回405
+type Router struct {
+	prefix string
+	routes []route
+}
+
+func NewRouter(prefix string) *Router {
+	return &Router{prefix: strings.TrimRight(prefix, "/")}
+}
+
+// Handle 注册路由, pattern 中 {name} 形式的路径段为参数
+func (rt *Router) Handle(method string, pattern string, handler HandlerFunc) {
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		segments: split(pattern),
+		handler:  handler,
+	})
+}
+
+func (rt *Router) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	path := request.URL.Path
+	if !strings.HasPrefix(path, rt.prefix) {
+		writeError(writer, http.StatusNotFound, CodeNotFound, "接口不存在")
+		return
+	}
+	segments := split(strings.TrimPrefix(path, rt.prefix))
+
+	var allowed []string
+	for _, r := range rt.routes {
+		params, ok := match(r.segments, segments)
+		if !ok {
+			continue
+		}
+		if r.method != request.Method {
+			allowed = append(allowed, r.method)
+			continue
+		}
+		r.handler(writer, request, params)
+		return
+	}
+
+	if len(allowed) > 0 {
+		sort.Strings(allowed)
+		writer.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(writer, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "不支持的请求方法: "+request.Method)
+		return
+	}
+	writeError(writer, http.StatusNotFound, CodeNotFound, "接口不存在")
+}
+
+func match(pattern []string, segments []string) (Params, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	params := Params{}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			params[p[1:len(p)-1]] = segments[i]
+			continue
+		}
+		if p != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func split(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
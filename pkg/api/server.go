@@ -0,0 +1,323 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/hub"
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/task"
+)
+
+// Prefix 接口路径前缀
+const Prefix = "/api/v1"
+
+// PlanTimeout 生成运行计划的最长时间
+const PlanTimeout = 2 * time.Minute
+
+//go:embed openapi.json
+var openapi []byte
+
+// Server REST 接口
+type Server struct {
+	Runs   *task.Manager
+	Events *hub.Hub
+	Auth   *Auth
+	// SaveConfig 持久化并应用新的配置
+	SaveConfig func(config.Config) error
+}
+
+// Handler 返回挂载在 Prefix 下的路由
+func (s *Server) Handler() http.Handler {
+	router := NewRouter(Prefix)
+
+	router.Handle(http.MethodGet, "/openapi.json", s.openapi)
+
+	router.Handle(http.MethodGet, "/users", s.listUsers)
+
+	router.Handle(http.MethodGet, "/courses", s.listCourses)
+	router.Handle(http.MethodGet, "/courses/{id}", s.getCourse)
+	router.Handle(http.MethodGet, "/calendar", s.calendar)
+
+	router.Handle(http.MethodGet, "/runs", s.listRuns)
+	router.Handle(http.MethodPost, "/runs", s.startRun)
+	router.Handle(http.MethodGet, "/runs/{id}", s.getRun)
+	router.Handle(http.MethodPost, "/runs/{id}/cancel", s.cancelRun)
+	router.Handle(http.MethodGet, "/runs/{id}/progress", s.runProgress)
+	router.Handle(http.MethodGet, "/runs/{id}/courses", s.runCourses)
+	router.Handle(http.MethodGet, "/runs/{id}/manual", s.runManual)
+
+	router.Handle(http.MethodGet, "/config", s.getConfig)
+	router.Handle(http.MethodPut, "/config", s.putConfig)
+
+	router.Handle(http.MethodGet, "/logs", s.listLogs)
+
+	return router
+}
+
+func (s *Server) openapi(writer http.ResponseWriter, _ *http.Request, _ Params) {
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = writer.Write(openapi)
+}
+
+// UserView 用户信息, 不包含密码
+type UserView struct {
+	Username    string   `json:"username"`
+	Platform    string   `json:"platform"`
+	BaseURL     string   `json:"base_url"`
+	SchoolID    int      `json:"school_id"`
+	CourseNames []string `json:"course_names"`
+	Limit       int      `json:"limit"`
+}
+
+func (s *Server) listUsers(writer http.ResponseWriter, _ *http.Request, _ Params) {
+	users := []UserView{}
+	for _, user := range config.Get().Users {
+		users = append(users, UserView{
+			Username:    user.Username,
+			Platform:    user.Platform,
+			BaseURL:     user.BaseURL,
+			SchoolID:    user.SchoolID,
+			CourseNames: user.CourseNames,
+			Limit:       user.Limit,
+		})
+	}
+	writeData(writer, http.StatusOK, users)
+}
+
+// lookupUser 根据 user 参数查找用户, 未指定时使用第一个用户
+func lookupUser(request *http.Request) (config.User, error) {
+	users := config.Get().Users
+	if len(users) == 0 {
+		return config.User{}, errors.New("未配置用户")
+	}
+	username := request.URL.Query().Get("user")
+	if username == "" {
+		return users[0], nil
+	}
+	for _, user := range users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return config.User{}, errors.New("未找到用户: " + username)
+}
+
+// fetchCourses 登录并获取用户的全部课程
+func fetchCourses(writer http.ResponseWriter, request *http.Request) ([]platform.Course, bool) {
+	user, err := lookupUser(request)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, CodeNotFound, err.Error())
+		return nil, false
+	}
+
+	driver, err := platform.New(user)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, CodeBadRequest, err.Error())
+		return nil, false
+	}
+	if err := driver.Login(request.Context()); err != nil {
+		writeError(writer, http.StatusBadGateway, CodeUpstream, "登录失败: "+err.Error())
+		return nil, false
+	}
+	courses, err := driver.ListCourses(request.Context())
+	if err != nil {
+		writeError(writer, http.StatusBadGateway, CodeUpstream, "获取课程列表失败: "+err.Error())
+		return nil, false
+	}
+	return courses, true
+}
+
+// listCourses 获取课程列表, name 参数按名称模糊匹配
+func (s *Server) listCourses(writer http.ResponseWriter, request *http.Request, _ Params) {
+	courses, ok := fetchCourses(writer, request)
+	if !ok {
+		return
+	}
+
+	result := []platform.Course{}
+	if name := request.URL.Query().Get("name"); name != "" {
+		result = append(result, task.MatchCourses(courses, name)...)
+	} else {
+		result = append(result, courses...)
+	}
+	writeData(writer, http.StatusOK, result)
+}
+
+func (s *Server) getCourse(writer http.ResponseWriter, request *http.Request, params Params) {
+	courseID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, CodeBadRequest, "无效的课程ID格式")
+		return
+	}
+
+	courses, ok := fetchCourses(writer, request)
+	if !ok {
+		return
+	}
+	for _, course := range courses {
+		if course.ID == courseID {
+			writeData(writer, http.StatusOK, course)
+			return
+		}
+	}
+	writeError(writer, http.StatusNotFound, CodeNotFound, "未找到指定课程")
+}
+
+// calendar 按结课时间排列用户的课程, 最近一次运行获取过章节的课程附带剩余视频时长
+func (s *Server) calendar(writer http.ResponseWriter, request *http.Request, _ Params) {
+	courses, ok := fetchCourses(writer, request)
+	if !ok {
+		return
+	}
+
+	remaining := map[int]int{}
+	if run := s.Runs.Latest(); run != nil {
+		user, _ := lookupUser(request)
+		remaining = run.Remaining(user.Username)
+	}
+	writeData(writer, http.StatusOK, task.Calendar(courses, remaining, time.Now()))
+}
+
+func (s *Server) listRuns(writer http.ResponseWriter, _ *http.Request, _ Params) {
+	infos := []task.RunInfo{}
+	for _, run := range s.Runs.List() {
+		infos = append(infos, run.Info())
+	}
+	writeData(writer, http.StatusOK, infos)
+}
+
+// startRun 开始新的运行, dry_run=true 时只返回运行计划, 不学习任何节点
+func (s *Server) startRun(writer http.ResponseWriter, request *http.Request, _ Params) {
+	if value := request.URL.Query().Get("dry_run"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, CodeBadRequest, "无效的 dry_run 参数")
+			return
+		}
+		if dryRun {
+			// 平台无响应时不让请求无限等待, 超时的用户在计划中记录错误
+			ctx, cancel := context.WithTimeout(request.Context(), PlanTimeout)
+			defer cancel()
+			writeData(writer, http.StatusOK, task.MakePlan(ctx, config.Get().Users))
+			return
+		}
+	}
+
+	run, err := s.Runs.Launch(config.Get().Users)
+	if errors.Is(err, task.ErrRunActive) {
+		writeError(writer, http.StatusConflict, CodeConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	writeData(writer, http.StatusAccepted, run.Info())
+}
+
+// lookupRun 根据路径参数查找运行
+func (s *Server) lookupRun(writer http.ResponseWriter, params Params) (*task.Run, bool) {
+	run, ok := s.Runs.Get(params["id"])
+	if !ok {
+		writeError(writer, http.StatusNotFound, CodeNotFound, task.ErrRunNotFound.Error())
+	}
+	return run, ok
+}
+
+func (s *Server) getRun(writer http.ResponseWriter, _ *http.Request, params Params) {
+	if run, ok := s.lookupRun(writer, params); ok {
+		writeData(writer, http.StatusOK, run.Info())
+	}
+}
+
+func (s *Server) cancelRun(writer http.ResponseWriter, _ *http.Request, params Params) {
+	err := s.Runs.Cancel(params["id"])
+	switch {
+	case errors.Is(err, task.ErrRunNotFound):
+		writeError(writer, http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, task.ErrRunFinished):
+		writeError(writer, http.StatusConflict, CodeConflict, err.Error())
+	case err != nil:
+		writeError(writer, http.StatusInternalServerError, CodeInternal, err.Error())
+	default:
+		run, _ := s.Runs.Get(params["id"])
+		writeData(writer, http.StatusOK, run.Info())
+	}
+}
+
+func (s *Server) runProgress(writer http.ResponseWriter, _ *http.Request, params Params) {
+	if run, ok := s.lookupRun(writer, params); ok {
+		writeData(writer, http.StatusOK, run.GetProgressTree())
+	}
+}
+
+func (s *Server) runCourses(writer http.ResponseWriter, _ *http.Request, params Params) {
+	if run, ok := s.lookupRun(writer, params); ok {
+		writeData(writer, http.StatusOK, run.GetUserCourseProgress())
+	}
+}
+
+// runManual 需要手动完成的作业、考试等节点
+func (s *Server) runManual(writer http.ResponseWriter, _ *http.Request, params Params) {
+	if run, ok := s.lookupRun(writer, params); ok {
+		writeData(writer, http.StatusOK, run.ManualWork())
+	}
+}
+
+// getConfig 获取配置, 仅已认证的管理员指定 reveal=true 时返回密码与令牌
+func (s *Server) getConfig(writer http.ResponseWriter, request *http.Request, _ Params) {
+	conf := config.Get()
+	if request.URL.Query().Get("reveal") == "true" && s.Auth.IsAdmin(request) {
+		writeData(writer, http.StatusOK, conf)
+		return
+	}
+	writeData(writer, http.StatusOK, conf.Redact())
+}
+
+func (s *Server) putConfig(writer http.ResponseWriter, request *http.Request, _ Params) {
+	var conf config.Config
+	if err := json.NewDecoder(request.Body).Decode(&conf); err != nil {
+		writeError(writer, http.StatusBadRequest, CodeBadRequest, "无效的配置格式: "+err.Error())
+		return
+	}
+	// 未填写的密码保持不变
+	conf = conf.KeepSecrets(config.Get())
+	if err := s.SaveConfig(conf); err != nil {
+		var invalid config.ValidationError
+		if errors.As(err, &invalid) {
+			writeFieldErrors(writer, invalid)
+			return
+		}
+		writeError(writer, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	writeData(writer, http.StatusOK, config.Get().Redact())
+}
+
+// listLogs 获取最近的日志行, limit 参数限制返回行数
+func (s *Server) listLogs(writer http.ResponseWriter, request *http.Request, _ Params) {
+	lines := []string{}
+	for _, msg := range s.Events.RecentLogs() {
+		if line, ok := msg.Data.(string); ok {
+			lines = append(lines, line)
+		}
+	}
+	if value := request.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			writeError(writer, http.StatusBadRequest, CodeBadRequest, "无效的 limit 参数")
+			return
+		}
+		if limit < len(lines) {
+			lines = lines[len(lines)-limit:]
+		}
+	}
+	writeData(writer, http.StatusOK, lines)
+}
@@ -1,21 +1,36 @@
 package config
 
 type Config struct {
-	Global Global `json:"global"`
-	Users  []User `json:"users"`
+	Global Global `json:"global" yaml:"global" toml:"global"`
+	Users  []User `json:"users" yaml:"users" toml:"users"`
 }
 type Global struct {
-	Server string `json:"server"`
-	Limit  int    `json:"limit"`
+	Server string `json:"server" yaml:"server" toml:"server"`
+	Limit  int    `json:"limit" yaml:"limit" toml:"limit"`
+	Resume bool   `json:"resume" yaml:"resume" toml:"resume"` // 启动时恢复上次未结束的运行
+	// AdminPassword 网页控制台登录密码, 与 Token 均为空时不启用认证
+	AdminPassword string `json:"admin_password" yaml:"admin_password" toml:"admin_password"`
+	// Token 接口调用使用的 Bearer Token
+	Token string `json:"token" yaml:"token" toml:"token"`
+	// Schedule 课程调度策略, 见 Schedule* 常量, 为空时按结课时间调度
+	Schedule string `json:"schedule" yaml:"schedule" toml:"schedule"`
 }
 type User struct {
-	BaseURL    string   `json:"base_url"`
-	SchoolID   int      `json:"school_id"`
-	Username   string   `json:"username"`
-	Password   string   `json:"password"`
-	CourseNames []string `json:"course_names"`
-}
+	// Platform 网课平台, 为空时使用英华学堂
+	Platform string `json:"platform,omitempty" yaml:"platform,omitempty" toml:"platform,omitempty"`
+	BaseURL  string `json:"base_url" yaml:"base_url" toml:"base_url"`
+	SchoolID int    `json:"school_id" yaml:"school_id" toml:"school_id"`
+	Username string `json:"username" yaml:"username" toml:"username"`
+	Password string `json:"password" yaml:"password" toml:"password"`
+	// PasswordFile 从文件读取密码, 如 Docker secret
+	PasswordFile string `json:"password_file,omitempty" yaml:"password_file,omitempty" toml:"password_file,omitempty"`
+	// PasswordEnv 从指定的环境变量读取密码
+	PasswordEnv string   `json:"password_env,omitempty" yaml:"password_env,omitempty" toml:"password_env,omitempty"`
+	CourseNames []string `json:"course_names" yaml:"course_names" toml:"course_names"`
+	Limit       int      `json:"limit" yaml:"limit" toml:"limit"` // 单用户并发课程数, 为0时使用 Global.Limit
 
-var Conf Config
+	// source 密码来源, 非配置文件中的密码保存配置时不写入文件
+	source string
+}
 
 const VERSION = "v1.3.3plus"
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 环境变量名称
+// 用户配置的序号从0开始, 对应配置文件中 users 的顺序
+const (
+	EnvServer        = "MOOC_SERVER"
+	EnvLimit         = "MOOC_LIMIT"
+	EnvResume        = "MOOC_RESUME"
+	EnvAdminPassword = "MOOC_ADMIN_PASSWORD"
+	EnvToken         = "MOOC_TOKEN"
+	EnvSchedule      = "MOOC_SCHEDULE"
+	EnvUserPrefix    = "MOOC_USERS_"
+)
+
+// 用户密码来源
+const (
+	sourceConfig       = ""
+	sourcePasswordEnv  = "password_env"
+	sourcePasswordFile = "password_file"
+	sourceEnv          = "env"
+)
+
+// ResolvePasswords 根据 password_env 与 password_file 读取用户密码
+// 同时设置时 password_env 优先, 均未设置时使用配置中的 password
+func (c *Config) ResolvePasswords() error {
+	var errs []FieldError
+	for i := range c.Users {
+		user := &c.Users[i]
+		path := fmt.Sprintf("users[%d]", i)
+		switch {
+		case user.PasswordEnv != "":
+			password, ok := os.LookupEnv(user.PasswordEnv)
+			if !ok || password == "" {
+				errs = append(errs, FieldError{path + ".password_env", "环境变量 " + user.PasswordEnv + " 未设置"})
+				continue
+			}
+			user.Password = password
+			user.source = sourcePasswordEnv
+		case user.PasswordFile != "":
+			data, err := os.ReadFile(user.PasswordFile)
+			if err != nil {
+				errs = append(errs, FieldError{path + ".password_file", "读取失败: " + err.Error()})
+				continue
+			}
+			user.Password = strings.TrimRight(string(data), "\r\n")
+			user.source = sourcePasswordFile
+		}
+	}
+	if len(errs) > 0 {
+		return ValidationError(errs)
+	}
+	return nil
+}
+
+// ApplyEnv 使用环境变量覆盖配置, 优先级高于配置文件、password_env 与 password_file
+// 全局: MOOC_SERVER, MOOC_LIMIT, MOOC_RESUME, MOOC_ADMIN_PASSWORD, MOOC_TOKEN, MOOC_SCHEDULE
+// 用户: MOOC_USERS_<序号>_USERNAME, MOOC_USERS_<序号>_PASSWORD
+func (c *Config) ApplyEnv() error {
+	var errs []FieldError
+
+	if value, ok := os.LookupEnv(EnvServer); ok {
+		c.Global.Server = value
+	}
+	if value, ok := os.LookupEnv(EnvLimit); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, FieldError{EnvLimit, "不是有效的整数: " + value})
+		} else {
+			c.Global.Limit = limit
+		}
+	}
+	if value, ok := os.LookupEnv(EnvResume); ok {
+		resume, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, FieldError{EnvResume, "不是有效的布尔值: " + value})
+		} else {
+			c.Global.Resume = resume
+		}
+	}
+	if value, ok := os.LookupEnv(EnvAdminPassword); ok {
+		c.Global.AdminPassword = value
+	}
+	if value, ok := os.LookupEnv(EnvToken); ok {
+		c.Global.Token = value
+	}
+	if value, ok := os.LookupEnv(EnvSchedule); ok {
+		c.Global.Schedule = value
+	}
+
+	for _, env := range os.Environ() {
+		key, value := env, ""
+		if i := strings.Index(env, "="); i >= 0 {
+			key, value = env[:i], env[i+1:]
+		}
+		if !strings.HasPrefix(key, EnvUserPrefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(key, EnvUserPrefix), "_", 2)
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			errs = append(errs, FieldError{key, "无法识别的环境变量, 格式为 " + EnvUserPrefix + "<序号>_USERNAME 或 _PASSWORD"})
+			continue
+		}
+		if index < 0 || index >= len(c.Users) {
+			errs = append(errs, FieldError{key, fmt.Sprintf("配置中不存在 users[%d]", index)})
+			continue
+		}
+		user := &c.Users[index]
+		switch parts[1] {
+		case "USERNAME":
+			user.Username = value
+		case "PASSWORD":
+			user.Password = value
+			user.source = sourceEnv
+		default:
+			errs = append(errs, FieldError{key, "仅支持覆盖 USERNAME 与 PASSWORD"})
+		}
+	}
+
+	if len(errs) > 0 {
+		return ValidationError(errs)
+	}
+	return nil
+}
+
+// Persistable 返回写入配置文件的副本: 来自环境变量与密码文件的值不写入文件
+// 这些字段保留 file (当前配置文件内容) 中的原值
+func (c Config) Persistable(file Config) Config {
+	if _, ok := os.LookupEnv(EnvServer); ok {
+		c.Global.Server = file.Global.Server
+	}
+	if _, ok := os.LookupEnv(EnvLimit); ok {
+		c.Global.Limit = file.Global.Limit
+	}
+	if _, ok := os.LookupEnv(EnvResume); ok {
+		c.Global.Resume = file.Global.Resume
+	}
+	if _, ok := os.LookupEnv(EnvAdminPassword); ok {
+		c.Global.AdminPassword = file.Global.AdminPassword
+	}
+	if _, ok := os.LookupEnv(EnvToken); ok {
+		c.Global.Token = file.Global.Token
+	}
+	if _, ok := os.LookupEnv(EnvSchedule); ok {
+		c.Global.Schedule = file.Global.Schedule
+	}
+
+	passwords := make(map[string]string, len(file.Users))
+	for _, user := range file.Users {
+		passwords[user.Username] = user.Password
+	}
+	users := make([]User, len(c.Users))
+	for i, user := range c.Users {
+		// MOOC_USERS_<序号>_* 按序号覆盖, 同样按序号还原文件中的用户名与密码
+		_, username := os.LookupEnv(userEnv(i, "USERNAME"))
+		_, password := os.LookupEnv(userEnv(i, "PASSWORD"))
+		switch {
+		case (username || password) && i < len(file.Users):
+			user.Username = file.Users[i].Username
+			user.Password = file.Users[i].Password
+		case password:
+			user.Password = ""
+		case user.source != sourceConfig:
+			user.Password = passwords[user.Username]
+		}
+		users[i] = user
+	}
+	c.Users = users
+	return c
+}
+
+// userEnv 用户配置的环境变量名, 如 MOOC_USERS_0_USERNAME
+func userEnv(index int, field string) string {
+	return fmt.Sprintf("%s%d_%s", EnvUserPrefix, index, field)
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// PathEnv 配置文件路径环境变量
+const PathEnv = "MOOC_CONFIG"
+
+// 配置文件格式
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// DefaultPaths 未指定配置文件时依次查找的路径
+var DefaultPaths = []string{"./config.json", "./config.yaml", "./config.yml", "./config.toml"}
+
+// ResolvePath 获取配置文件路径: 参数 > 环境变量 MOOC_CONFIG > 当前目录下第一个存在的默认文件
+func ResolvePath(path string) string {
+	if path != "" {
+		return path
+	}
+	if path = os.Getenv(PathEnv); path != "" {
+		return path
+	}
+	for _, p := range DefaultPaths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return DefaultPaths[0]
+}
+
+// FormatOf 根据扩展名判断配置文件格式, 无法识别时按 JSON 处理
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// Unmarshal 按格式解析配置
+func Unmarshal(data []byte, format string, conf *Config) error {
+	switch format {
+	case FormatJSON:
+		return json.Unmarshal(data, conf)
+	case FormatYAML:
+		return yaml.Unmarshal(data, conf)
+	case FormatTOML:
+		return toml.Unmarshal(data, conf)
+	}
+	return errors.New("不支持的配置格式: " + format)
+}
+
+// Marshal 按格式序列化配置
+func Marshal(conf Config, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(conf, "", "  ")
+	case FormatYAML:
+		return yaml.Marshal(conf)
+	case FormatTOML:
+		var buf bytes.Buffer
+		encoder := toml.NewEncoder(&buf)
+		encoder.Indent = ""
+		if err := encoder.Encode(conf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, errors.New("不支持的配置格式: " + format)
+}
@@ -0,0 +1,54 @@
+package config
+
+// AuthEnabled 是否启用网页控制台认证
+func (g Global) AuthEnabled() bool {
+	return g.AdminPassword != "" || g.Token != ""
+}
+
+// Redact 返回隐藏了所有密码与令牌的配置副本
+func (c Config) Redact() Config {
+	c.Global.AdminPassword = ""
+	c.Global.Token = ""
+	users := make([]User, len(c.Users))
+	for i, user := range c.Users {
+		user.Password = ""
+		users[i] = user
+	}
+	c.Users = users
+	return c
+}
+
+// KeepSecrets 将为空的密码与令牌用旧配置中的值补全, 使提交脱敏后的配置不会清空密码
+// 网页端没有的字段同样从旧配置补全
+func (c Config) KeepSecrets(old Config) Config {
+	if c.Global.AdminPassword == "" {
+		c.Global.AdminPassword = old.Global.AdminPassword
+	}
+	if c.Global.Token == "" {
+		c.Global.Token = old.Global.Token
+	}
+	olds := make(map[string]User, len(old.Users))
+	for _, user := range old.Users {
+		olds[user.Username] = user
+	}
+	users := make([]User, len(c.Users))
+	for i, user := range c.Users {
+		o, ok := olds[user.Username]
+		if ok && user.Platform == "" {
+			// 网页端不提交 platform
+			user.Platform = o.Platform
+		}
+		if ok && user.Password == "" {
+			// 密码来源一并保留, 网页端不会提交 password_file 与 password_env
+			user.Password = o.Password
+			user.source = o.source
+			if user.PasswordFile == "" && user.PasswordEnv == "" {
+				user.PasswordFile = o.PasswordFile
+				user.PasswordEnv = o.PasswordEnv
+			}
+		}
+		users[i] = user
+	}
+	c.Users = users
+	return c
+}
@@ -0,0 +1,17 @@
+package config
+
+import "sync/atomic"
+
+// current 当前生效的配置, 整体原子替换, 读取方拿到的快照不会被并发修改
+var current atomic.Value
+
+// Get 获取当前配置的快照, 调用方不应修改其中的切片
+func Get() Config {
+	conf, _ := current.Load().(Config)
+	return conf
+}
+
+// Set 原子替换当前配置, 已获取的快照不受影响
+func Set(conf Config) {
+	current.Store(conf)
+}
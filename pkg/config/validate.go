@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// 默认值
+const (
+	DefaultServer = ":10086"
+	DefaultLimit  = 3
+)
+
+// 课程调度策略
+const (
+	ScheduleFIFO     = "fifo"     // 按平台返回的课程顺序
+	ScheduleDeadline = "deadline" // 结课时间越早越优先
+	ScheduleProgress = "progress" // 课程进度越低越优先
+	ScheduleDuration = "duration" // 剩余视频时长越短越优先
+
+	DefaultSchedule = ScheduleDeadline
+)
+
+// Schedules 支持的课程调度策略
+var Schedules = []string{ScheduleFIFO, ScheduleDeadline, ScheduleProgress, ScheduleDuration}
+
+// SchoolIDRequiredHost 使用该平台时必须填写 school_id
+const SchoolIDRequiredHost = "mooc.yinghuaonline.com"
+
+// FieldError 单个字段的校验错误, Field 为字段路径, 如 users[0].base_url
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError 配置校验错误, 包含全部字段问题
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, field := range e {
+		messages[i] = field.Error()
+	}
+	return "配置校验失败: " + strings.Join(messages, "; ")
+}
+
+// Validate 校验配置并填充默认值, 存在问题时返回 ValidationError
+func (c *Config) Validate() error {
+	errs := c.Global.validate("global")
+
+	seen := make(map[string]int)
+	for i := range c.Users {
+		path := fmt.Sprintf("users[%d]", i)
+		errs = append(errs, c.Users[i].validate(path)...)
+
+		username := c.Users[i].Username
+		if username == "" {
+			continue
+		}
+		if j, ok := seen[username]; ok {
+			errs = append(errs, FieldError{path + ".username", fmt.Sprintf("与 users[%d] 重复", j)})
+			continue
+		}
+		seen[username] = i
+	}
+
+	if len(errs) > 0 {
+		return ValidationError(errs)
+	}
+	return nil
+}
+
+func (g *Global) validate(path string) []FieldError {
+	var errs []FieldError
+	if g.Server == "" {
+		g.Server = DefaultServer
+	}
+	switch {
+	case g.Limit < 0:
+		errs = append(errs, FieldError{path + ".limit", "不能小于0"})
+	case g.Limit == 0:
+		g.Limit = DefaultLimit
+	}
+	g.Schedule = strings.ToLower(strings.TrimSpace(g.Schedule))
+	if g.Schedule == "" {
+		g.Schedule = DefaultSchedule
+	} else if !validSchedule(g.Schedule) {
+		errs = append(errs, FieldError{path + ".schedule", "不支持的调度策略, 可选值: " + strings.Join(Schedules, ", ")})
+	}
+	return errs
+}
+
+func validSchedule(schedule string) bool {
+	for _, s := range Schedules {
+		if s == schedule {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验用户配置
+func (u *User) Validate() error {
+	if errs := u.validate("user"); len(errs) > 0 {
+		return ValidationError(errs)
+	}
+	return nil
+}
+
+func (u *User) validate(path string) []FieldError {
+	var errs []FieldError
+
+	u.BaseURL = strings.TrimSpace(u.BaseURL)
+	if u.BaseURL == "" {
+		errs = append(errs, FieldError{path + ".base_url", "不能为空"})
+	} else if host, err := baseHost(u.BaseURL); err != nil {
+		errs = append(errs, FieldError{path + ".base_url", "无效的地址: " + err.Error()})
+	} else if strings.EqualFold(host, SchoolIDRequiredHost) && u.SchoolID == 0 {
+		errs = append(errs, FieldError{path + ".school_id", "使用 " + SchoolIDRequiredHost + " 时为必填项"})
+	}
+	if u.SchoolID < 0 {
+		errs = append(errs, FieldError{path + ".school_id", "不能小于0"})
+	}
+
+	u.Username = strings.TrimSpace(u.Username)
+	if u.Username == "" {
+		errs = append(errs, FieldError{path + ".username", "不能为空"})
+	}
+	if u.Password == "" {
+		errs = append(errs, FieldError{path + ".password", "不能为空"})
+	}
+	for i, name := range u.CourseNames {
+		if strings.TrimSpace(name) == "" {
+			errs = append(errs, FieldError{fmt.Sprintf("%s.course_names[%d]", path, i), "不能为空"})
+		}
+	}
+	if u.Limit < 0 {
+		errs = append(errs, FieldError{path + ".limit", "不能小于0"})
+	}
+	return errs
+}
+
+// baseHost 解析平台地址的主机名, 未填写协议时按 http 处理
+func baseHost(baseURL string) (string, error) {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Hostname() == "" {
+		return "", fmt.Errorf("缺少主机名")
+	}
+	return parsed.Hostname(), nil
+}
@@ -0,0 +1,29 @@
+package hub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogHook 将 logrus 日志发布到 Hub
+type LogHook struct {
+	hub *Hub
+}
+
+func NewLogHook(hub *Hub) *LogHook {
+	return &LogHook{hub: hub}
+}
+
+func (h *LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 以与日志文件相同的格式发布不带颜色的日志行
+func (h *LogHook) Fire(entry *logrus.Entry) error {
+	line := fmt.Sprintf("[%s] [%s] %s",
+		entry.Time.Format("2006-01-02 15:04:05"), entry.Level.String(), strings.TrimSpace(entry.Message))
+	h.hub.Publish(TypeLog, line)
+	return nil
+}
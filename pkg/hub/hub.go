@@ -0,0 +1,97 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// 消息类型
+const (
+	TypeLog      = "log"      // 日志行
+	TypeRun      = "run"      // 运行状态变化
+	TypeProgress = "progress" // 课程进度更新
+)
+
+// subscriberBuffer 每个订阅者的缓冲大小, 消费过慢的订阅者会丢弃消息
+const subscriberBuffer = 256
+
+// Message 发布到 Hub 的消息
+type Message struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Hub 进程内的发布订阅中心, 并保留最近的日志行供新订阅者回放
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[chan Message]struct{}
+	logs    []Message
+	logSize int
+}
+
+// New 创建 Hub, logSize 为保留的最近日志行数
+func New(logSize int) *Hub {
+	return &Hub{
+		subs:    make(map[chan Message]struct{}),
+		logSize: logSize,
+	}
+}
+
+// Publish 向所有订阅者发布消息, 不会阻塞发布方
+func (h *Hub) Publish(typ string, data interface{}) {
+	if h == nil {
+		return
+	}
+	msg := Message{Type: typ, Time: time.Now(), Data: data}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if typ == TypeLog && h.logSize > 0 {
+		h.logs = append(h.logs, msg)
+		if len(h.logs) > h.logSize {
+			h.logs = h.logs[len(h.logs)-h.logSize:]
+		}
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// Subscribe 订阅消息, 返回的函数用于取消订阅
+func (h *Hub) Subscribe() (<-chan Message, func()) {
+	_, ch, unsubscribe := h.SubscribeWithLogs()
+	return ch, unsubscribe
+}
+
+// SubscribeWithLogs 订阅消息并返回订阅时的最近日志
+// 快照与订阅在同一把锁内完成, 回放的日志不会再从通道收到, 回放期间产生的消息也不会遗漏
+func (h *Hub) SubscribeWithLogs() ([]Message, <-chan Message, func()) {
+	ch := make(chan Message, subscriberBuffer)
+
+	h.mu.Lock()
+	logs := append([]Message(nil), h.logs...)
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return logs, ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// RecentLogs 获取最近的日志消息
+func (h *Hub) RecentLogs() []Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Message(nil), h.logs...)
+}
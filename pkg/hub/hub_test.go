@@ -0,0 +1,67 @@
+package hub_test
+
+import (
+	"testing"
+
+	"github.com/aoaostar/mooc/pkg/hub"
+)
+
+func TestSubscribeWithLogsDoesNotRepeatReplayedLogs(t *testing.T) {
+	h := hub.New(10)
+	h.Publish(hub.TypeLog, "第一行")
+	h.Publish(hub.TypeLog, "第二行")
+
+	logs, messages, unsubscribe := h.SubscribeWithLogs()
+	defer unsubscribe()
+	h.Publish(hub.TypeLog, "第三行")
+
+	if len(logs) != 2 || logs[0].Data != "第一行" || logs[1].Data != "第二行" {
+		t.Fatalf("回放日志 = %+v, 期望前两行", logs)
+	}
+	if msg := <-messages; msg.Data != "第三行" {
+		t.Errorf("收到 %v, 期望第三行", msg.Data)
+	}
+	select {
+	case msg := <-messages:
+		t.Errorf("多收到消息 %v", msg.Data)
+	default:
+	}
+}
+
+func TestSubscribeWithLogsConcurrentPublish(t *testing.T) {
+	h := hub.New(1000)
+	// 不超过订阅者缓冲, 避免未及时读取的消息被丢弃
+	const total = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < total; i++ {
+			h.Publish(hub.TypeLog, i)
+		}
+	}()
+
+	logs, messages, unsubscribe := h.SubscribeWithLogs()
+	defer unsubscribe()
+	<-done
+
+	// 回放与通道中的日志合起来应恰好是全部日志, 且按发布顺序排列
+	next := 0
+	for _, msg := range logs {
+		if msg.Data != next {
+			t.Fatalf("回放日志第 %d 行 = %v", next, msg.Data)
+		}
+		next++
+	}
+	for next < total {
+		msg := <-messages
+		if msg.Data != next {
+			t.Fatalf("收到 %v, 期望 %d", msg.Data, next)
+		}
+		next++
+	}
+	select {
+	case msg := <-messages:
+		t.Errorf("多收到消息 %v", msg.Data)
+	default:
+	}
+}
@@ -0,0 +1,57 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 平台接口错误分类, 驱动返回的 *Error 可以通过 errors.Is 判断类别
+var (
+	// ErrAuth 登录失败, 如用户名或密码错误, 重试无意义
+	ErrAuth = errors.New("登录失败")
+	// ErrTokenExpired 登录状态已失效, 重新登录后可继续
+	ErrTokenExpired = errors.New("登录已失效")
+	// ErrNodeLocked 节点尚未解锁
+	ErrNodeLocked = errors.New("节点未解锁")
+	// ErrCaptchaRequired 需要输入验证码
+	ErrCaptchaRequired = errors.New("需要验证码")
+	// ErrRateLimited 请求过于频繁, 稍后重试
+	ErrRateLimited = errors.New("请求过于频繁")
+	// ErrServer 平台返回了其他错误
+	ErrServer = errors.New("平台接口错误")
+)
+
+// Error 平台接口返回的错误, 保留原始错误码与消息
+type Error struct {
+	// Kind 错误分类, 为上面的 Err* 之一
+	Kind error
+	// Code 接口返回的错误码, 非接口返回的错误为0
+	Code int
+	// Status HTTP 状态码, 接口正常响应时为0
+	Status int
+	Msg    string
+}
+
+// NewError 创建平台接口错误
+func NewError(kind error, code int, msg string) *Error {
+	return &Error{Kind: kind, Code: code, Msg: msg}
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = e.Kind.Error()
+	}
+	switch {
+	case e.Status != 0:
+		return fmt.Sprintf("%s[status=%d]", msg, e.Status)
+	case e.Code != 0:
+		return fmt.Sprintf("%s[code=%d]", msg, e.Code)
+	}
+	return msg
+}
+
+// Unwrap 返回错误分类, 使 errors.Is(err, ErrTokenExpired) 等判断生效
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
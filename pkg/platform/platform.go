@@ -0,0 +1,123 @@
+package platform
+
+import (
+	"context"
+	"time"
+)
+
+// Course 课程
+type Course struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Progress 平台统计的课程进度 0-1
+	Progress float64 `json:"progress"`
+	// ProgressText 平台显示的进度文本
+	ProgressText string `json:"progress_text"`
+	// Ended 课程已结束, 无法继续学习
+	Ended     bool   `json:"ended"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	// StartAt, EndAt 由驱动解析的开课与结课时间, 零值表示未知
+	StartAt time.Time `json:"-"`
+	EndAt   time.Time `json:"-"`
+}
+
+// Chapter 章节
+type Chapter struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+	Nodes []Node `json:"nodes"`
+}
+
+// NodeType 节点内容类型
+type NodeType string
+
+const (
+	NodeVideo   NodeType = "video"   // 视频, 自动学习
+	NodeFile    NodeType = "file"    // 文档资料
+	NodeVote    NodeType = "vote"    // 投票
+	NodeWork    NodeType = "work"    // 作业
+	NodeExam    NodeType = "exam"    // 考试
+	NodeUnknown NodeType = "unknown" // 无法识别的内容
+)
+
+// Node 章节中的学习节点
+type Node struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+	// Video 是否为视频节点, 目前只有视频节点会被自动学习
+	Video bool `json:"video"`
+	// Types 节点包含的全部内容类型, 一个节点可以同时包含视频与作业等
+	Types []NodeType `json:"types"`
+	// URL 节点的外部链接, 如投票地址
+	URL string `json:"url,omitempty"`
+	// Duration 视频时长, 单位秒, 未知时为0
+	Duration int `json:"duration"`
+	// Done 平台已记录学习完成
+	Done bool `json:"done"`
+	// Locked 节点未解锁, 无法学习
+	Locked bool `json:"locked"`
+	// UnlockAt 节点的解锁时间, 零值表示未知, 如需要先完成前面的节点
+	UnlockAt time.Time `json:"unlock_at"`
+}
+
+// Manual 节点中需要手动完成的内容类型
+func (n Node) Manual() []NodeType {
+	var types []NodeType
+	for _, t := range n.Types {
+		if t != NodeVideo {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// NodeProgress 节点学习进度
+type NodeProgress struct {
+	// Percent 进度 0-100
+	Percent float64
+	// Duration 视频时长, 单位秒, 未知时为0
+	Duration int
+	Done     bool
+}
+
+// Checkpoint 节点学习断点, 进程中断后从断点继续学习
+type Checkpoint struct {
+	StudyID   int
+	StudyTime int
+	Done      bool
+}
+
+// Study 学习单个节点的参数
+type Study struct {
+	Course  Course
+	Chapter Chapter
+	Node    Node
+	// Checkpoint 上次中断的位置, 零值表示从头开始
+	Checkpoint Checkpoint
+	// OnProgress 每次上报学习时长后调用, 可为空
+	OnProgress func(NodeProgress, Checkpoint)
+}
+
+// Progress 上报学习进度, 未设置 OnProgress 时忽略
+func (s Study) Progress(progress NodeProgress, checkpoint Checkpoint) {
+	if s.OnProgress != nil {
+		s.OnProgress(progress, checkpoint)
+	}
+}
+
+// Driver 网课平台驱动, 每个用户的每门课程使用独立的实例
+type Driver interface {
+	// Login 登录平台
+	Login(ctx context.Context) error
+	// ListCourses 获取在学课程
+	ListCourses(ctx context.Context) ([]Course, error)
+	// ListChapters 获取课程的章节与节点
+	ListChapters(ctx context.Context, course Course) ([]Chapter, error)
+	// StudyNode 学习单个节点直到完成, 返回 nil 表示节点已完成, 上下文取消时立即返回
+	StudyNode(ctx context.Context, study Study) error
+	// NodeProgress 获取节点的学习进度
+	NodeProgress(ctx context.Context, node Node) (NodeProgress, error)
+}
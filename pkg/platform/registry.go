@@ -0,0 +1,65 @@
+package platform
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/aoaostar/mooc/pkg/config"
+)
+
+// Default 用户未配置 platform 时使用的平台
+const Default = "yinghua"
+
+// Factory 根据用户配置创建驱动
+type Factory func(user config.User) Driver
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register 注册平台驱动, 通常在驱动包的 init 中调用, 重复注册时覆盖
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = factory
+}
+
+// Registered 平台是否已注册, 空名称表示默认平台
+func Registered(name string) bool {
+	if name == "" {
+		name = Default
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// Names 获取已注册的平台名称
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 根据用户配置的 platform 创建驱动
+func New(user config.User) (Driver, error) {
+	name := user.Platform
+	if name == "" {
+		name = Default
+	}
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, errors.New("不支持的平台: " + name)
+	}
+	return factory(user), nil
+}
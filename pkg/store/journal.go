@@ -0,0 +1,405 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 日志记录类型
+const (
+	TypeRunStart = "run_start"
+	TypeRunEnd   = "run_end"
+	TypeCourse   = "course"
+	TypeNode     = "node"
+)
+
+// 课程状态
+const (
+	CourseQueued = "pending"
+	CourseDone   = "completed"
+	CourseFailed = "failed"
+)
+
+// DefaultDir 默认数据目录
+const DefaultDir = "./data"
+
+const journalName = "journal.jsonl"
+
+// Record 运行日志中的一行
+type Record struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	RunID     string    `json:"run_id,omitempty"`
+	Users     []string  `json:"users,omitempty"`
+	User      string    `json:"user,omitempty"`
+	CourseID  int       `json:"course_id,omitempty"`
+	NodeID    int       `json:"node_id,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	StudyID   int       `json:"study_id,omitempty"`
+	StudyTime int       `json:"study_time,omitempty"`
+	Done      bool      `json:"done,omitempty"`
+}
+
+// RunRecord 从日志中还原的运行状态
+type RunRecord struct {
+	ID        string
+	CreatedAt time.Time
+	Users     []string
+	// Courses 每个用户本次运行登记的课程ID及其状态
+	Courses  map[string]map[int]string
+	Finished bool
+	// State 结束时记录的运行状态, 未结束时为空
+	State string
+}
+
+// NodeRecord 节点学习断点
+type NodeRecord struct {
+	StudyID   int
+	StudyTime int
+	Done      bool
+	UpdatedAt time.Time
+}
+
+type nodeKey struct {
+	runID    string
+	user     string
+	courseID int
+	nodeID   int
+}
+
+// Journal 基于 JSON Lines 的本地运行日志, 记录运行、课程与节点的学习状态
+type Journal struct {
+	mu    sync.Mutex
+	file  *os.File
+	runs  map[string]*RunRecord
+	nodes map[nodeKey]NodeRecord
+}
+
+// Open 打开(或创建)目录下的运行日志并载入已有记录
+// 载入后压缩日志文件, 只保留每个运行、课程与节点的最新记录, 已结束运行的节点断点不再保留
+func Open(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	filename := filepath.Join(dir, journalName)
+
+	j := &Journal{
+		runs:  make(map[string]*RunRecord),
+		nodes: make(map[nodeKey]NodeRecord),
+	}
+	if err := j.load(filename); err != nil {
+		return nil, err
+	}
+	if err := j.compact(filename); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+	return j, nil
+}
+
+// Load 只读地载入目录下运行日志中的全部运行, 按创建时间排序
+// 不会创建目录或日志文件, 也不会压缩日志, 可以在其他进程写入时使用; 日志不存在时没有运行
+func Load(dir string) ([]RunRecord, error) {
+	j := &Journal{
+		runs:  make(map[string]*RunRecord),
+		nodes: make(map[nodeKey]NodeRecord),
+	}
+	if err := j.load(filepath.Join(dir, journalName)); err != nil {
+		return nil, err
+	}
+	return j.Runs(), nil
+}
+
+func (j *Journal) load(filename string) error {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for s.Scan() {
+		line++
+		var rec Record
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			// 进程被强制结束时最后一行可能不完整
+			logrus.Warnf("运行日志第 %d 行损坏, 已忽略: %v", line, err)
+			continue
+		}
+		j.apply(rec)
+	}
+	return s.Err()
+}
+
+// apply 将一条记录合并到内存索引
+func (j *Journal) apply(rec Record) {
+	switch rec.Type {
+	case TypeRunStart:
+		j.runs[rec.RunID] = &RunRecord{
+			ID:        rec.RunID,
+			CreatedAt: rec.Time,
+			Users:     rec.Users,
+			Courses:   make(map[string]map[int]string),
+		}
+	case TypeRunEnd:
+		if run, ok := j.runs[rec.RunID]; ok {
+			run.Finished = true
+			run.State = rec.Status
+		}
+		// 结束的运行不会被恢复, 其节点断点不再需要
+		for key := range j.nodes {
+			if key.runID == rec.RunID {
+				delete(j.nodes, key)
+			}
+		}
+	case TypeCourse:
+		if run, ok := j.runs[rec.RunID]; ok {
+			if run.Courses[rec.User] == nil {
+				run.Courses[rec.User] = make(map[int]string)
+			}
+			run.Courses[rec.User][rec.CourseID] = rec.Status
+		}
+	case TypeNode:
+		j.nodes[nodeKey{rec.RunID, rec.User, rec.CourseID, rec.NodeID}] = NodeRecord{
+			StudyID:   rec.StudyID,
+			StudyTime: rec.StudyTime,
+			Done:      rec.Done,
+			UpdatedAt: rec.Time,
+		}
+	}
+}
+
+// compact 按内存索引重写日志文件, 先写入临时文件再替换, 中途失败不影响原文件
+func (j *Journal) compact(filename string) error {
+	tmp := filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for _, rec := range j.records() {
+		if err = encoder.Encode(rec); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("压缩运行日志失败: %w", err)
+	}
+	return nil
+}
+
+// records 将内存索引还原为日志记录, 按运行的创建时间排序, 不属于任何运行的节点断点被丢弃
+func (j *Journal) records() []Record {
+	now := time.Now()
+	nodes := make(map[string][]nodeKey)
+	for key := range j.nodes {
+		nodes[key.runID] = append(nodes[key.runID], key)
+	}
+
+	var records []Record
+	for _, run := range j.sortedRuns() {
+		records = append(records, Record{Type: TypeRunStart, Time: run.CreatedAt, RunID: run.ID, Users: run.Users})
+
+		users := make([]string, 0, len(run.Courses))
+		for user := range run.Courses {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		for _, user := range users {
+			ids := make([]int, 0, len(run.Courses[user]))
+			for id := range run.Courses[user] {
+				ids = append(ids, id)
+			}
+			sort.Ints(ids)
+			for _, id := range ids {
+				records = append(records, Record{Type: TypeCourse, Time: now, RunID: run.ID, User: user, CourseID: id, Status: run.Courses[user][id]})
+			}
+		}
+
+		keys := nodes[run.ID]
+		sort.Slice(keys, func(a, b int) bool {
+			if keys[a].user != keys[b].user {
+				return keys[a].user < keys[b].user
+			}
+			if keys[a].courseID != keys[b].courseID {
+				return keys[a].courseID < keys[b].courseID
+			}
+			return keys[a].nodeID < keys[b].nodeID
+		})
+		for _, key := range keys {
+			node := j.nodes[key]
+			records = append(records, Record{
+				Type:      TypeNode,
+				Time:      node.UpdatedAt,
+				RunID:     run.ID,
+				User:      key.user,
+				CourseID:  key.courseID,
+				NodeID:    key.nodeID,
+				StudyID:   node.StudyID,
+				StudyTime: node.StudyTime,
+				Done:      node.Done,
+			})
+		}
+
+		if run.Finished {
+			records = append(records, Record{Type: TypeRunEnd, Time: now, RunID: run.ID, Status: run.State})
+		}
+	}
+	return records
+}
+
+// sortedRuns 按创建时间排序的运行, 调用方需持有 j.mu 或独占 j
+func (j *Journal) sortedRuns() []*RunRecord {
+	runs := make([]*RunRecord, 0, len(j.runs))
+	for _, run := range j.runs {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(a, b int) bool {
+		if !runs[a].CreatedAt.Equal(runs[b].CreatedAt) {
+			return runs[a].CreatedAt.Before(runs[b].CreatedAt)
+		}
+		return runs[a].ID < runs[b].ID
+	})
+	return runs
+}
+
+// append 写入一条记录, 写入失败只记录日志不影响任务执行
+func (j *Journal) append(rec Record) {
+	if j == nil {
+		return
+	}
+	rec.Time = time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.apply(rec)
+	data, err := json.Marshal(rec)
+	if err != nil {
+		logrus.Error("序列化运行日志失败: ", err)
+		return
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		logrus.Error("写入运行日志失败: ", err)
+	}
+}
+
+// RunStarted 记录运行开始
+func (j *Journal) RunStarted(runID string, users []string) {
+	j.append(Record{Type: TypeRunStart, RunID: runID, Users: users})
+}
+
+// RunFinished 记录运行结束(完成或取消), 结束的运行不会被恢复
+func (j *Journal) RunFinished(runID string, state string) {
+	j.append(Record{Type: TypeRunEnd, RunID: runID, Status: state})
+}
+
+// CourseStatus 记录课程状态
+func (j *Journal) CourseStatus(runID string, user string, courseID int, status string) {
+	j.append(Record{Type: TypeCourse, RunID: runID, User: user, CourseID: courseID, Status: status})
+}
+
+// SaveNode 记录节点学习断点
+func (j *Journal) SaveNode(runID string, user string, courseID int, nodeID int, node NodeRecord) {
+	j.append(Record{
+		Type:      TypeNode,
+		RunID:     runID,
+		User:      user,
+		CourseID:  courseID,
+		NodeID:    nodeID,
+		StudyID:   node.StudyID,
+		StudyTime: node.StudyTime,
+		Done:      node.Done,
+	})
+}
+
+// Node 获取运行中记录的节点学习断点, 其他运行的断点不会返回
+func (j *Journal) Node(runID string, user string, courseID int, nodeID int) (NodeRecord, bool) {
+	if j == nil {
+		return NodeRecord{}, false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	node, ok := j.nodes[nodeKey{runID, user, courseID, nodeID}]
+	return node, ok
+}
+
+// Unfinished 返回没有结束记录的运行, 按创建时间排序
+func (j *Journal) Unfinished() []RunRecord {
+	var result []RunRecord
+	for _, run := range j.Runs() {
+		if !run.Finished {
+			result = append(result, run)
+		}
+	}
+	return result
+}
+
+// Runs 返回日志中的全部运行, 按创建时间排序
+func (j *Journal) Runs() []RunRecord {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var result []RunRecord
+	for _, run := range j.sortedRuns() {
+		courses := make(map[string]map[int]string, len(run.Courses))
+		for user, list := range run.Courses {
+			courses[user] = make(map[int]string, len(list))
+			for id, status := range list {
+				courses[user][id] = status
+			}
+		}
+		rec := *run
+		rec.Courses = courses
+		result = append(result, rec)
+	}
+	return result
+}
+
+// Close 关闭日志文件
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("同步运行日志失败: %w", err)
+	}
+	return j.file.Close()
+}
@@ -0,0 +1,99 @@
+package store_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoaostar/mooc/pkg/store"
+)
+
+func open(t *testing.T, dir string) *store.Journal {
+	t.Helper()
+	journal, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return journal
+}
+
+func lines(t *testing.T, dir string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestOpenCompactsJournal(t *testing.T) {
+	dir := t.TempDir()
+	journal := open(t, dir)
+	journal.RunStarted("finished", []string{"alice"})
+	journal.CourseStatus("finished", "alice", 1, store.CourseQueued)
+	journal.SaveNode("finished", "alice", 1, 100, store.NodeRecord{StudyID: 1, StudyTime: 11, Done: true})
+	journal.CourseStatus("finished", "alice", 1, store.CourseDone)
+	journal.RunFinished("finished", "completed")
+
+	journal.RunStarted("unfinished", []string{"alice"})
+	journal.CourseStatus("unfinished", "alice", 1, store.CourseQueued)
+	for studyTime := 1; studyTime <= 51; studyTime += 10 {
+		journal.SaveNode("unfinished", "alice", 1, 100, store.NodeRecord{StudyID: 2, StudyTime: studyTime})
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	journal = open(t, dir)
+	defer journal.Close()
+	// 两次运行开始、两条课程状态、一次运行结束与未结束运行的一条节点断点
+	if n := lines(t, dir); n != 6 {
+		t.Errorf("压缩后 %d 行, 期望 6", n)
+	}
+	if _, ok := journal.Node("finished", "alice", 1, 100); ok {
+		t.Errorf("已结束运行的节点断点应被丢弃")
+	}
+	if node, ok := journal.Node("unfinished", "alice", 1, 100); !ok || node.StudyTime != 51 || node.StudyID != 2 {
+		t.Errorf("节点断点 = %+v, 期望最新的断点", node)
+	}
+
+	runs := journal.Runs()
+	if len(runs) != 2 || runs[0].ID != "finished" || !runs[0].Finished || runs[0].State != "completed" {
+		t.Fatalf("运行记录 = %+v", runs)
+	}
+	if status := runs[0].Courses["alice"][1]; status != store.CourseDone {
+		t.Errorf("课程状态 = %s, 期望 %s", status, store.CourseDone)
+	}
+	if unfinished := journal.Unfinished(); len(unfinished) != 1 || unfinished[0].ID != "unfinished" {
+		t.Errorf("未结束的运行 = %+v", unfinished)
+	}
+}
+
+func TestLoadIsReadOnly(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	runs, err := store.Load(dir)
+	if err != nil || len(runs) != 0 {
+		t.Fatalf("运行 = %+v, %v, 期望没有运行", runs, err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("不应创建数据目录: %v", err)
+	}
+
+	journal := open(t, dir)
+	defer journal.Close()
+	journal.RunStarted("run", []string{"alice"})
+	journal.CourseStatus("run", "alice", 1, store.CourseDone)
+	before := lines(t, dir)
+
+	runs, err = store.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != "run" || runs[0].Courses["alice"][1] != store.CourseDone {
+		t.Errorf("运行 = %+v", runs)
+	}
+	if after := lines(t, dir); after != before {
+		t.Errorf("载入后日志 %d 行, 期望保持 %d 行", after, before)
+	}
+}
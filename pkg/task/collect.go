@@ -0,0 +1,84 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/util"
+	"github.com/sirupsen/logrus"
+)
+
+// Collect 登录并获取单个用户需要处理的课程任务
+func Collect(ctx context.Context, user config.User) ([]Task, error) {
+	_, tasks, err := collect(ctx, user)
+	return tasks, err
+}
+
+// collect 登录并获取单个用户需要处理的课程任务, 同时返回已登录的驱动
+func collect(ctx context.Context, user config.User) (platform.Driver, []Task, error) {
+	driver, err := platform.New(user)
+	if err != nil {
+		return nil, nil, fmt.Errorf("用户 %s: %v", user.Username, err)
+	}
+
+	err = driver.Login(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("用户 %s 登录失败: %v", user.Username, err)
+	}
+	util.Output(user.Username, "登录成功", logrus.Infof)
+
+	all, err := driver.ListCourses(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("用户 %s 获取课程列表失败: %v", user.Username, err)
+	}
+
+	util.Output(user.Username, fmt.Sprintf("获取全部在学课程成功, 共计 %d 门\n", len(all)), logrus.Infof)
+
+	// 如果没有指定课程名称，则添加所有课程
+	courses := all
+
+	// 检查是否指定了课程名称
+	if len(user.CourseNames) > 0 {
+		// 根据课程名称筛选课程
+		courses = nil
+		for _, name := range user.CourseNames {
+			matched := MatchCourses(all, name)
+			if len(matched) == 0 {
+				logrus.Warn(fmt.Sprintf("未找到课程: '%s'", name))
+			} else {
+				courses = append(courses, matched...)
+				util.Output(user.Username, fmt.Sprintf("找到课程: '%s', 共 %d 个匹配结果", name, len(matched)), logrus.Infof)
+			}
+		}
+	}
+
+	// 同一课程可能被多个名称匹配, 只添加一次, 避免同时在两个协程中学习
+	var tasks []Task
+	added := make(map[int]bool)
+	for _, course := range courses {
+		if added[course.ID] {
+			continue
+		}
+		added[course.ID] = true
+		tasks = append(tasks, Task{
+			User:   user,
+			Course: course,
+			Status: false,
+		})
+	}
+	return driver, tasks, nil
+}
+
+// MatchCourses 根据课程名称查找课程（模糊匹配, 不区分大小写）
+func MatchCourses(courses []platform.Course, name string) []platform.Course {
+	var result []platform.Course
+	for _, course := range courses {
+		if strings.Contains(strings.ToLower(course.Name), strings.ToLower(name)) {
+			result = append(result, course)
+		}
+	}
+	return result
+}
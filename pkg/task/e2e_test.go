@@ -0,0 +1,751 @@
+package task_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/store"
+	"github.com/aoaostar/mooc/pkg/task"
+	"github.com/aoaostar/mooc/pkg/yinghua"
+	"github.com/aoaostar/mooc/pkg/yinghua/yinghuatest"
+	"github.com/sirupsen/logrus"
+)
+
+// testPlatform 使用模拟服务且缩短轮询间隔的英华学堂驱动
+const testPlatform = "yinghua-test"
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+	platform.Register(testPlatform, func(user config.User) platform.Driver {
+		driver := yinghua.New(user)
+		driver.Interval = 5 * time.Millisecond
+		driver.ReloginBackoff = time.Millisecond
+		driver.Solver = func(ctx context.Context, image []byte) (string, error) {
+			return "abcd", nil
+		}
+		return driver
+	})
+	config.Set(config.Config{Global: config.Global{Limit: 3}})
+	os.Exit(m.Run())
+}
+
+// newServer 启动模拟服务并添加测试用户
+func newServer(t *testing.T) *yinghuatest.Server {
+	t.Helper()
+	srv := yinghuatest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddUser("alice", "secret")
+	return srv
+}
+
+func newUser(srv *yinghuatest.Server) config.User {
+	return config.User{
+		Platform: testPlatform,
+		BaseURL:  srv.URL,
+		Username: "alice",
+		Password: "secret",
+	}
+}
+
+func newJournal(t *testing.T) *store.Journal {
+	t.Helper()
+	journal, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = journal.Close() })
+	return journal
+}
+
+// execute 同步执行一次运行
+func execute(t *testing.T, manager *task.Manager, users ...config.User) *task.Run {
+	t.Helper()
+	var usernames []string
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	run, err := manager.StartRun(usernames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executeRun(t, run, users...)
+}
+
+// executeRun 同步执行已创建的运行
+func executeRun(t *testing.T, run *task.Run, users ...config.User) *task.Run {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run.Execute(users)
+		run.Finish()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("运行超时")
+	}
+	return run
+}
+
+func courseStatus(run *task.Run, user string, courseID int) string {
+	return run.GetUserCourseProgress()[user][courseID].Status
+}
+
+func TestRunStudiesAllVideoNodes(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"),
+		yinghuatest.Chapter(10, "第一章",
+			yinghuatest.VideoNode(100, "导论", 30),
+			yinghuatest.WorkNode(101, "课后作业"),
+			yinghuatest.VideoNode(102, "极限", 25),
+		),
+		yinghuatest.Chapter(11, "第二章",
+			yinghuatest.VideoNode(110, "导数", 15),
+		),
+	)
+
+	run := execute(t, task.NewManager(newJournal(t), nil), newUser(srv))
+
+	if run.State() != task.RunCompleted {
+		t.Fatalf("运行状态 = %s, 期望 %s", run.State(), task.RunCompleted)
+	}
+	if run.Failed() != 0 {
+		t.Fatalf("失败数 = %d, 期望 0", run.Failed())
+	}
+	for _, id := range []int{100, 102, 110} {
+		if progress := srv.Progress(id); progress < 1 {
+			t.Errorf("节点 %d 进度 = %.2f, 期望完成", id, progress)
+		}
+	}
+	if status := courseStatus(run, "alice", 1); status != task.StateCompleted {
+		t.Errorf("课程状态 = %s, 期望 %s", status, task.StateCompleted)
+	}
+	if percent := run.GetProgressTree().Users["alice"][0].Percent; percent != 100 {
+		t.Errorf("课程进度 = %.2f, 期望 100", percent)
+	}
+}
+
+func TestRunFiltersCourseNames(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+	srv.AddCourse(yinghuatest.Course(2, "大学英语"), yinghuatest.Chapter(20, "Unit 1", yinghuatest.VideoNode(200, "Reading", 10)))
+
+	user := newUser(srv)
+	user.CourseNames = []string{"英语"}
+	run := execute(t, task.NewManager(nil, nil), user)
+
+	if jobs := run.Jobs(); len(jobs) != 1 || jobs[0].Course.ID != 2 {
+		t.Fatalf("任务 = %+v, 期望仅包含课程 2", jobs)
+	}
+	if srv.Progress(100) != 0 {
+		t.Errorf("未选择的课程不应被学习")
+	}
+	if srv.Progress(200) < 1 {
+		t.Errorf("选择的课程未完成")
+	}
+}
+
+func TestRunAddsMatchedCourseOnce(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+	srv.AddCourse(yinghuatest.Course(2, "大学英语"), yinghuatest.Chapter(20, "Unit 1", yinghuatest.VideoNode(200, "Reading", 10)))
+
+	user := newUser(srv)
+	// 空名称匹配全部课程, 高等数学被三个名称匹配
+	user.CourseNames = []string{"数学", "高等", ""}
+	run := execute(t, task.NewManager(nil, nil), user)
+
+	jobs := run.Jobs()
+	if len(jobs) != 2 || jobs[0].Course.ID != 1 || jobs[1].Course.ID != 2 {
+		t.Fatalf("任务 = %+v, 期望课程 1、2 各一次", jobs)
+	}
+	if total, _, _ := run.GetProgress(); total != 2 {
+		t.Errorf("任务总数 = %d, 期望 2", total)
+	}
+}
+
+func TestRunSkipsFinishedAndEndedCourses(t *testing.T) {
+	srv := newServer(t)
+	finished := yinghuatest.Course(1, "已完成课程")
+	finished.Progress, finished.Progress1 = 1, "100%"
+	ended := yinghuatest.Course(2, "已结束课程")
+	ended.State = 2
+	srv.AddCourse(finished, yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+	srv.AddCourse(ended, yinghuatest.Chapter(20, "第一章", yinghuatest.VideoNode(200, "导论", 10)))
+
+	run := execute(t, task.NewManager(nil, nil), newUser(srv))
+
+	if n := srv.Requests("/api/course/chapter.json"); n != 0 {
+		t.Errorf("获取章节 %d 次, 期望 0", n)
+	}
+	for _, id := range []int{1, 2} {
+		if status := courseStatus(run, "alice", id); status != task.StateCompleted {
+			t.Errorf("课程 %d 状态 = %s, 期望 %s", id, status, task.StateCompleted)
+		}
+	}
+}
+
+func TestRunSkipsFailedNode(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"),
+		yinghuatest.Chapter(10, "第一章",
+			yinghuatest.VideoNode(100, "导论", 10),
+			yinghuatest.VideoNode(101, "极限", 10),
+		),
+	)
+	srv.Fail("/api/node/study.json", yinghuatest.Failure{Code: 1, Msg: "节点尚未解锁"})
+
+	run := execute(t, task.NewManager(nil, nil), newUser(srv))
+
+	if srv.Progress(100) != 0 {
+		t.Errorf("失败的节点不应有进度")
+	}
+	if srv.Progress(101) < 1 {
+		t.Errorf("失败节点之后的节点未完成")
+	}
+	nodes := run.GetProgressTree().Users["alice"][0].Chapters[0].Nodes
+	if nodes[0].State != task.StateFailed {
+		t.Errorf("节点状态 = %s, 期望 %s", nodes[0].State, task.StateFailed)
+	}
+}
+
+func TestRunSolvesCaptcha(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 20)))
+	srv.RequireCaptcha(100, 2)
+
+	run := execute(t, task.NewManager(nil, nil), newUser(srv))
+
+	if srv.Progress(100) < 1 {
+		t.Errorf("需要验证码的节点未完成")
+	}
+	if n := srv.Requests("/service/code/aa"); n < 1 {
+		t.Errorf("获取验证码 %d 次, 期望至少 1 次", n)
+	}
+	if status := courseStatus(run, "alice", 1); status != task.StateCompleted {
+		t.Errorf("课程状态 = %s, 期望 %s", status, task.StateCompleted)
+	}
+}
+
+// resumeJournal 创建包含一次未结束运行的运行日志, alice 的课程1尚未完成
+func resumeJournal(t *testing.T) *store.Journal {
+	t.Helper()
+	journal := newJournal(t)
+	journal.RunStarted("previous", []string{"alice"})
+	journal.CourseStatus("previous", "alice", 1, store.CourseQueued)
+	return journal
+}
+
+// resume 恢复运行日志中未结束的运行并同步执行
+func resume(t *testing.T, journal *store.Journal, users ...config.User) *task.Run {
+	t.Helper()
+	run, err := task.NewManager(journal, nil).Resume()
+	if err != nil || run == nil {
+		t.Fatalf("恢复运行 = %v, %v", run, err)
+	}
+	return executeRun(t, run, users...)
+}
+
+func TestRunResumesFromCheckpoint(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"),
+		yinghuatest.Chapter(10, "第一章",
+			yinghuatest.VideoNode(100, "导论", 60),
+			yinghuatest.VideoNode(101, "极限", 10),
+		),
+	)
+	journal := resumeJournal(t)
+	journal.SaveNode("previous", "alice", 1, 100, store.NodeRecord{StudyID: 1, StudyTime: 51})
+
+	resume(t, journal, newUser(srv))
+
+	for _, id := range []int{100, 101} {
+		if srv.Progress(id) < 1 {
+			t.Errorf("节点 %d 未学完", id)
+		}
+	}
+	// 节点100从断点继续只需上报 51、61 两次, 从头学习需要 7 次
+	if n := srv.Requests("/api/node/study.json"); n > 4 {
+		t.Errorf("上报学时 %d 次, 期望从断点继续", n)
+	}
+	if node, ok := journal.Node("previous", "alice", 1, 101); ok {
+		t.Errorf("节点断点 = %+v, 运行结束后不应保留", node)
+	}
+}
+
+func TestRunResumesFromCompactedJournal(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 60)))
+
+	dir := t.TempDir()
+	journal, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.RunStarted("previous", []string{"alice"})
+	journal.CourseStatus("previous", "alice", 1, store.CourseQueued)
+	for studyTime := 1; studyTime <= 51; studyTime += 10 {
+		journal.SaveNode("previous", "alice", 1, 100, store.NodeRecord{StudyID: 1, StudyTime: studyTime})
+	}
+	// 重新打开两次, 第二次载入的是已压缩的日志
+	for i := 0; i < 2; i++ {
+		if err := journal.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if journal, err = store.Open(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = journal.Close() })
+
+	resume(t, journal, newUser(srv))
+
+	if srv.Progress(100) < 1 {
+		t.Errorf("节点未学完")
+	}
+	if n := srv.Requests("/api/node/study.json"); n > 2 {
+		t.Errorf("上报学时 %d 次, 期望从断点继续", n)
+	}
+}
+
+func TestRunRestudiesNodeUnfinishedOnPlatform(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+	journal := resumeJournal(t)
+	journal.SaveNode("previous", "alice", 1, 100, store.NodeRecord{StudyID: 1, StudyTime: 11, Done: true})
+
+	resume(t, journal, newUser(srv))
+
+	if srv.Progress(100) < 1 {
+		t.Errorf("平台显示未完成的节点应重新学习")
+	}
+}
+
+func TestRunIgnoresCheckpointsOfOtherRuns(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+	journal := newJournal(t)
+	journal.SaveNode("previous", "alice", 1, 100, store.NodeRecord{StudyID: 1, StudyTime: 11, Done: true})
+
+	run := execute(t, task.NewManager(journal, nil), newUser(srv))
+
+	if srv.Progress(100) < 1 {
+		t.Errorf("其他运行的断点不应影响本次运行")
+	}
+	if node, ok := journal.Node(run.ID, "alice", 1, 100); ok {
+		t.Errorf("节点断点 = %+v, 运行结束后不应保留", node)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 3600)))
+
+	manager := task.NewManager(nil, nil)
+	go func() {
+		for srv.Requests("/api/node/study.json") < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		if run := manager.Active(); run != nil {
+			_ = manager.Cancel(run.ID)
+		}
+	}()
+	run := execute(t, manager, newUser(srv))
+
+	if run.State() != task.RunCanceled {
+		t.Fatalf("运行状态 = %s, 期望 %s", run.State(), task.RunCanceled)
+	}
+	if srv.Progress(100) >= 1 {
+		t.Errorf("取消的节点不应完成")
+	}
+	if status := courseStatus(run, "alice", 1); status != task.StateFailed {
+		t.Errorf("课程状态 = %s, 期望 %s", status, task.StateFailed)
+	}
+}
+
+func TestRunCancelFailsQueuedCourses(t *testing.T) {
+	previous := config.Get()
+	config.Set(config.Config{Global: config.Global{Limit: 1, Schedule: config.ScheduleFIFO}})
+	t.Cleanup(func() { config.Set(previous) })
+
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 3600)))
+	srv.AddCourse(yinghuatest.Course(2, "线性代数"), yinghuatest.Chapter(20, "第一章", yinghuatest.VideoNode(200, "导论", 3600)))
+
+	manager := task.NewManager(nil, nil)
+	go func() {
+		for srv.Requests("/api/node/study.json") < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		if run := manager.Active(); run != nil {
+			_ = manager.Cancel(run.ID)
+		}
+	}()
+	run := execute(t, manager, newUser(srv))
+
+	if run.State() != task.RunCanceled {
+		t.Fatalf("运行状态 = %s, 期望 %s", run.State(), task.RunCanceled)
+	}
+	for id := 1; id <= 2; id++ {
+		if status := courseStatus(run, "alice", id); status != task.StateFailed {
+			t.Errorf("课程 %d 状态 = %s, 期望 %s", id, status, task.StateFailed)
+		}
+	}
+}
+
+func TestRunLoginFailure(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+
+	user := newUser(srv)
+	user.Password = "wrong"
+	run := execute(t, task.NewManager(nil, nil), user)
+
+	if run.Failed() != 1 {
+		t.Errorf("失败数 = %d, 期望 1", run.Failed())
+	}
+	if len(run.Jobs()) != 0 {
+		t.Errorf("登录失败的用户不应产生任务")
+	}
+}
+
+func TestRunRenewsExpiredSession(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 60)))
+	go func() {
+		for srv.Requests("/api/node/study.json") < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		srv.ExpireTokens()
+	}()
+
+	run := execute(t, task.NewManager(nil, nil), newUser(srv))
+
+	if srv.Progress(100) < 1 {
+		t.Errorf("登录失效后节点未完成")
+	}
+	if status := courseStatus(run, "alice", 1); status != task.StateCompleted {
+		t.Errorf("课程状态 = %s, 期望 %s", status, task.StateCompleted)
+	}
+}
+
+func TestRunFailsCourseWhenReloginFails(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"),
+		yinghuatest.Chapter(10, "第一章",
+			yinghuatest.VideoNode(100, "导论", 60),
+			yinghuatest.VideoNode(101, "极限", 60),
+		),
+	)
+	go func() {
+		for srv.Requests("/api/node/study.json") < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		// 修改密码后无法重新登录
+		srv.AddUser("alice", "changed")
+		srv.ExpireTokens()
+	}()
+
+	run := execute(t, task.NewManager(nil, nil), newUser(srv))
+
+	if status := courseStatus(run, "alice", 1); status != task.StateFailed {
+		t.Errorf("课程状态 = %s, 期望 %s", status, task.StateFailed)
+	}
+	if srv.Progress(101) != 0 {
+		t.Errorf("登录失效后不应继续学习后续节点")
+	}
+	if run.Failed() != 1 {
+		t.Errorf("失败数 = %d, 期望 1", run.Failed())
+	}
+}
+
+func TestRunReportsManualWork(t *testing.T) {
+	srv := newServer(t)
+	video := yinghuatest.VideoNode(101, "极限", 10)
+	video.TabExam = true
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"),
+		yinghuatest.Chapter(10, "第一章",
+			yinghuatest.VideoNode(100, "导论", 10),
+			video,
+			yinghuatest.WorkNode(102, "课后作业"),
+			yinghuatest.VoteNode(103, "课程评价", "https://example.com/vote"),
+		),
+	)
+
+	run := execute(t, task.NewManager(nil, nil), newUser(srv))
+
+	if srv.Progress(101) < 1 {
+		t.Errorf("包含考试的视频节点仍应学习视频")
+	}
+	manual := run.ManualWork()["alice"]
+	if len(manual) != 1 || manual[0].CourseID != 1 {
+		t.Fatalf("手动完成列表 = %+v", manual)
+	}
+	want := []task.ManualItem{
+		{ChapterID: 10, ChapterName: "第一章", NodeID: 101, NodeName: "极限", Types: []platform.NodeType{platform.NodeExam}},
+		{ChapterID: 10, ChapterName: "第一章", NodeID: 102, NodeName: "课后作业", Types: []platform.NodeType{platform.NodeWork}},
+		{ChapterID: 10, ChapterName: "第一章", NodeID: 103, NodeName: "课程评价", Types: []platform.NodeType{platform.NodeVote}, URL: "https://example.com/vote"},
+	}
+	if !reflect.DeepEqual(manual[0].Items, want) {
+		t.Errorf("手动完成节点 = %+v, 期望 %+v", manual[0].Items, want)
+	}
+	if items := run.GetProgressTree().Users["alice"][0].Manual; len(items) != len(want) {
+		t.Errorf("进度树中的手动完成节点 = %d, 期望 %d", len(items), len(want))
+	}
+}
+
+func TestRunWaitsForLockedNode(t *testing.T) {
+	srv := newServer(t)
+	until := time.Unix(time.Now().Unix()+2, 0)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"),
+		yinghuatest.Chapter(10, "第一章",
+			yinghuatest.VideoNode(100, "导论", 10),
+			yinghuatest.Lock(yinghuatest.VideoNode(101, "极限", 10), until),
+		),
+	)
+
+	manager := task.NewManager(nil, nil)
+	waiting := make(chan task.NodeProgress, 1)
+	studied := make(chan int, 1)
+	go func() {
+		for {
+			run := manager.Active()
+			if run != nil && courseStatus(run, "alice", 1) == task.StateWaiting {
+				studied <- srv.NodeRequests(100)
+				waiting <- run.GetProgressTree().Users["alice"][0].Chapters[0].Nodes[1]
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	run := execute(t, manager, newUser(srv))
+
+	select {
+	case node := <-waiting:
+		if node.State != task.StateWaiting || node.WaitUntil == nil || !node.WaitUntil.Equal(until) {
+			t.Errorf("等待中的节点 = %+v, 期望等待至 %s", node, until)
+		}
+	default:
+		t.Fatal("未观察到等待解锁的状态")
+	}
+	if time.Now().Before(until) {
+		t.Errorf("运行在解锁时间之前结束")
+	}
+	if srv.Progress(101) < 1 {
+		t.Errorf("解锁后的节点未完成")
+	}
+	// 重新排队后已学完的节点不应再请求视频信息或上报学时
+	if before, after := <-studied, srv.NodeRequests(100); after != before {
+		t.Errorf("节点100请求 %d 次, 重新排队前为 %d 次", after, before)
+	}
+	if status := courseStatus(run, "alice", 1); status != task.StateCompleted {
+		t.Errorf("课程状态 = %s, 期望 %s", status, task.StateCompleted)
+	}
+}
+
+func TestRunCancelWhileWaiting(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"),
+		yinghuatest.Chapter(10, "第一章", yinghuatest.Lock(yinghuatest.VideoNode(100, "导论", 10), time.Now().Add(time.Hour))),
+	)
+
+	manager := task.NewManager(nil, nil)
+	go func() {
+		for {
+			if run := manager.Active(); run != nil && courseStatus(run, "alice", 1) == task.StateWaiting {
+				_ = manager.Cancel(run.ID)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	run := execute(t, manager, newUser(srv))
+
+	if run.State() != task.RunCanceled {
+		t.Fatalf("运行状态 = %s, 期望 %s", run.State(), task.RunCanceled)
+	}
+	if n := srv.Requests("/api/node/study.json"); n != 0 {
+		t.Errorf("未解锁的节点上报 %d 次, 期望 0", n)
+	}
+}
+
+func TestRunSkipsNotStartedCourse(t *testing.T) {
+	srv := newServer(t)
+	upcoming := yinghuatest.Course(1, "下学期课程")
+	upcoming.StartDate = time.Now().Add(24 * time.Hour).Format("2006-01-02 15:04:05")
+	srv.AddCourse(upcoming, yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+
+	run := execute(t, task.NewManager(nil, nil), newUser(srv))
+
+	if n := srv.Requests("/api/course/chapter.json"); n != 0 {
+		t.Errorf("获取章节 %d 次, 期望 0", n)
+	}
+	if status := courseStatus(run, "alice", 1); status != task.StateSkipped {
+		t.Errorf("课程状态 = %s, 期望 %s", status, task.StateSkipped)
+	}
+	if run.Failed() != 0 {
+		t.Errorf("失败数 = %d, 期望 0", run.Failed())
+	}
+}
+
+// withSchedule 单协程按指定调度策略运行, 测试结束后恢复配置
+func withSchedule(t *testing.T, schedule string) {
+	t.Helper()
+	previous := config.Get()
+	config.Set(config.Config{Global: config.Global{Limit: 1, Schedule: schedule}})
+	t.Cleanup(func() { config.Set(previous) })
+}
+
+func TestRunSchedulePolicies(t *testing.T) {
+	now := time.Now()
+	courses := []struct {
+		id       int
+		end      time.Time
+		progress float32
+		duration int
+	}{
+		{1, time.Time{}, 0.2, 20},
+		{2, now.AddDate(0, 0, 30), 0.5, 10},
+		{3, now.AddDate(0, 0, 7), 0.1, 30},
+	}
+	for _, tc := range []struct {
+		schedule string
+		want     []int
+	}{
+		{"", []int{3, 2, 1}},
+		{config.ScheduleFIFO, []int{1, 2, 3}},
+		{config.ScheduleDeadline, []int{3, 2, 1}},
+		{config.ScheduleProgress, []int{3, 1, 2}},
+		{config.ScheduleDuration, []int{2, 1, 3}},
+	} {
+		t.Run(tc.schedule, func(t *testing.T) {
+			withSchedule(t, tc.schedule)
+			srv := newServer(t)
+			for _, course := range courses {
+				c := yinghuatest.Course(course.id, fmt.Sprintf("课程%d", course.id))
+				if !course.end.IsZero() {
+					c.EndDate = course.end.Format("2006-01-02")
+				}
+				c.Progress = course.progress
+				srv.AddCourse(c, yinghuatest.Chapter(course.id*10, "第一章", yinghuatest.VideoNode(course.id*100, "导论", course.duration)))
+			}
+
+			execute(t, task.NewManager(nil, nil), newUser(srv))
+
+			var order []int
+			for _, id := range srv.StudyOrder() {
+				order = append(order, id/100)
+			}
+			if !reflect.DeepEqual(order, tc.want) {
+				t.Errorf("学习顺序 = %v, 期望 %v", order, tc.want)
+			}
+			// 获取课程时登录一次, 每门课程学习时各登录一次, 任何策略都不额外登录
+			if n := srv.Requests("/api/login.json"); n != 1+len(courses) {
+				t.Errorf("登录 %d 次, 期望 %d", n, 1+len(courses))
+			}
+		})
+	}
+}
+
+func TestRunRespectsUserLimit(t *testing.T) {
+	previous := config.Get()
+	config.Set(config.Config{Global: config.Global{Limit: 3, Schedule: config.ScheduleFIFO}})
+	t.Cleanup(func() { config.Set(previous) })
+
+	// 模拟服务的节点进度由所有用户共享, 两个用户各用一个服务, 保证都会上报学时
+	aliceSrv, bobSrv := newServer(t), newServer(t)
+	bobSrv.AddUser("bob", "secret")
+	for _, srv := range []*yinghuatest.Server{aliceSrv, bobSrv} {
+		for id := 1; id <= 3; id++ {
+			srv.AddCourse(yinghuatest.Course(id, fmt.Sprintf("课程%d", id)), yinghuatest.Chapter(id*10, "第一章", yinghuatest.VideoNode(id*100, "导论", 10)))
+		}
+		// 延长每次上报的处理时间, 使同时学习的课程在服务端重叠
+		srv.DelayStudy(20 * time.Millisecond)
+	}
+	alice := newUser(aliceSrv)
+	alice.Limit = 1
+	bob := newUser(bobSrv)
+	bob.Username = "bob"
+
+	run := execute(t, task.NewManager(nil, nil), alice, bob)
+
+	if run.Failed() != 0 || len(run.Jobs()) != 6 {
+		t.Fatalf("失败数 = %d, 任务数 = %d, 期望全部完成", run.Failed(), len(run.Jobs()))
+	}
+	for _, user := range []string{"alice", "bob"} {
+		for id := 1; id <= 3; id++ {
+			if status := courseStatus(run, user, id); status != task.StateCompleted {
+				t.Errorf("用户 %s 课程 %d 状态 = %s, 期望 %s", user, id, status, task.StateCompleted)
+			}
+		}
+	}
+	if peak := aliceSrv.PeakStudies("alice"); peak != 1 {
+		t.Errorf("alice 同时学习 %d 门课程, 期望 1", peak)
+	}
+	if peak := bobSrv.PeakStudies("bob"); peak < 2 {
+		t.Errorf("bob 同时学习 %d 门课程, 期望至少 2", peak)
+	}
+}
+
+func TestRunEstimatesRemainingTime(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"),
+		yinghuatest.Chapter(10, "第一章",
+			yinghuatest.VideoNode(100, "导论", 60),
+			yinghuatest.VideoNode(101, "极限", 60),
+		),
+	)
+
+	manager := task.NewManager(nil, nil)
+	observed := make(chan task.ProgressTree, 1)
+	go func() {
+		for {
+			if run := manager.Active(); run != nil {
+				tree := run.GetProgressTree()
+				if courses := tree.Users["alice"]; len(courses) > 0 && courses[0].Speed > 0 {
+					observed <- tree
+					return
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	run := execute(t, manager, newUser(srv))
+
+	var tree task.ProgressTree
+	select {
+	case tree = <-observed:
+	default:
+		t.Fatal("未观察到学习速度")
+	}
+	course := tree.Users["alice"][0]
+	if course.Remaining <= 0 || course.Remaining > 120 || course.Remaining != course.Chapters[0].Remaining {
+		t.Errorf("课程剩余时长 = %d, 章节剩余时长 = %d, 期望 (0, 120]", course.Remaining, course.Chapters[0].Remaining)
+	}
+	// 模拟服务每 5ms 上报 10 秒学时, 学习速度远快于实时播放
+	if course.ETA <= 0 || course.ETA >= course.Remaining || course.FinishAt == nil {
+		t.Errorf("课程预计剩余时间 = %d, 完成时间 = %v, 期望小于剩余时长 %d", course.ETA, course.FinishAt, course.Remaining)
+	}
+	if user := tree.Estimates["alice"]; user.ETA != course.ETA || user.Remaining != course.Remaining {
+		t.Errorf("用户估算 = %+v, 期望与课程一致", user)
+	}
+	if tree.Estimate.ETA != course.ETA || tree.Estimate.FinishAt == nil {
+		t.Errorf("运行估算 = %+v, 期望与课程一致", tree.Estimate)
+	}
+
+	final := run.GetProgressTree()
+	if final.Estimate.ETA != 0 || final.Estimate.Remaining != 0 || final.Estimate.FinishAt != nil {
+		t.Errorf("运行结束后的估算 = %+v, 期望为0", final.Estimate)
+	}
+	if course := final.Users["alice"][0]; course.Remaining != 0 || course.FinishAt != nil {
+		t.Errorf("学完后的课程 = %+v, 期望没有剩余时间", course)
+	}
+}
@@ -0,0 +1,128 @@
+package task
+
+import (
+	"math"
+	"time"
+)
+
+// Estimate 剩余时间估算
+type Estimate struct {
+	// Remaining 剩余视频时长, 单位秒
+	Remaining int `json:"remaining"`
+	// ETA 预计剩余学习时间, 单位秒
+	ETA int `json:"eta"`
+	// FinishAt 预计学完的时间, 没有剩余课程时为空
+	FinishAt *time.Time `json:"finish_at,omitempty"`
+}
+
+// remaining 节点剩余的视频时长, 单位秒
+func remaining(node NodeProgress) int {
+	if node.State == StateCompleted || node.Percent >= 100 {
+		return 0
+	}
+	return int(math.Ceil(float64(node.Duration) * (100 - node.Percent) / 100))
+}
+
+// observe 根据节点两次进度之间学习的视频时长与实际耗时累计学习速度
+func (c *CourseProgress) observe(node *NodeProgress, progress float64, now time.Time) {
+	if !node.reported || node.State != StateInProgress || progress <= node.Percent {
+		return
+	}
+	c.studied += float64(node.Duration) * (progress - node.Percent) / 100
+	c.elapsed += now.Sub(node.UpdatedAt)
+}
+
+// speed 观察到的学习速度, 每秒学习的视频秒数, 尚未观察到时返回0
+func (c *CourseProgress) speed() float64 {
+	if c.studied <= 0 || c.elapsed <= 0 {
+		return 0
+	}
+	return c.studied / c.elapsed.Seconds()
+}
+
+// eta 按学习速度估算学完 remaining 秒视频需要的时间, 未观察到学习速度时按实时播放估算
+func eta(remaining int, speed float64) int {
+	if remaining <= 0 {
+		return 0
+	}
+	if speed <= 0 {
+		return remaining
+	}
+	return int(math.Ceil(float64(remaining) / speed))
+}
+
+// unfinished 课程是否仍会继续学习
+func unfinished(state string) bool {
+	switch state {
+	case StateCompleted, StateFailed, StateSkipped:
+		return false
+	}
+	return true
+}
+
+// estimate 汇总多门课程的剩余时间, parallel 为可同时学习的课程数
+// 预计时间不短于耗时最长的一门课程, 也不短于全部课程平均分配到 parallel 个协程后的时间
+func estimate(courses []CourseProgress, parallel int, now time.Time) Estimate {
+	if parallel < 1 {
+		parallel = 1
+	}
+	var result Estimate
+	total, longest := 0, 0
+	for _, course := range courses {
+		if !unfinished(course.State) {
+			continue
+		}
+		result.Remaining += course.Remaining
+		total += course.ETA
+		if course.ETA > longest {
+			longest = course.ETA
+		}
+	}
+	result.ETA = (total + parallel - 1) / parallel
+	if longest > result.ETA {
+		result.ETA = longest
+	}
+	result.FinishAt = finishAt(result.ETA, now)
+	return result
+}
+
+// finishAt 剩余 eta 秒时的预计完成时间, 没有剩余时间时返回空
+func finishAt(eta int, now time.Time) *time.Time {
+	if eta <= 0 {
+		return nil
+	}
+	finish := now.Add(time.Duration(eta) * time.Second)
+	return &finish
+}
+
+// estimates 估算每个用户与整个运行的剩余时间, 调用方需持有 r.mu
+// 尚未获取章节的课程剩余时长未知, 不计入估算
+func (r *Run) estimates(users map[string][]CourseProgress, now time.Time) (map[string]Estimate, Estimate) {
+	limit := workers(r.limit)
+	limits := make(map[string]int)
+	for _, job := range r.jobs {
+		limits[job.User.Username] = userLimit(job.User, limit)
+	}
+	return estimateAll(users, limits, limit, now)
+}
+
+// estimateAll 按每个用户的课程数上限 limits 与全局协程数 limit 估算每个用户与全部课程的剩余时间
+func estimateAll(users map[string][]CourseProgress, limits map[string]int, limit int, now time.Time) (map[string]Estimate, Estimate) {
+	result := make(map[string]Estimate, len(users))
+	var all []CourseProgress
+	longest := 0
+	for user, courses := range users {
+		e := estimate(courses, limits[user], now)
+		result[user] = e
+		all = append(all, courses...)
+		if e.ETA > longest {
+			longest = e.ETA
+		}
+	}
+	run := estimate(all, limit, now)
+	if longest > run.ETA {
+		run.ETA = longest
+		run.FinishAt = finishAt(run.ETA, now)
+	}
+	return result, run
+}
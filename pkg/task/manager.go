@@ -0,0 +1,423 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/hub"
+	"github.com/aoaostar/mooc/pkg/store"
+)
+
+// RunState 运行状态
+type RunState string
+
+const (
+	RunRunning   RunState = "running"
+	RunCompleted RunState = "completed"
+	RunCanceled  RunState = "canceled"
+)
+
+var (
+	ErrRunActive   = errors.New("任务已经在运行中")
+	ErrRunNotFound = errors.New("未找到指定的运行")
+	ErrRunFinished = errors.New("任务未在运行中")
+)
+
+// RunInfo 运行概要信息
+type RunInfo struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Users     []string  `json:"users"`
+	State     RunState  `json:"state"`
+	Total     int       `json:"total"`
+	Completed int       `json:"completed"`
+}
+
+// Run 一次任务运行, 持有本次运行的全部课程任务及进度
+type Run struct {
+	ID        string
+	CreatedAt time.Time
+	Users     []string
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	journal *store.Journal
+	events  *hub.Hub
+	// resume 恢复运行时每个用户待继续的课程, 为空表示全新运行
+	resume map[string]map[int]bool
+
+	mu   sync.Mutex
+	jobs []Task
+	// limit 运行开始时配置的全局协程数, 运行期间修改配置不影响本次运行
+	limit int
+	// schedule 运行开始时配置的调度策略
+	schedule  string
+	state     RunState
+	completed int
+	// failures 获取课程失败的用户数
+	failures int
+	progress map[string]map[int]UserCourseProgress
+	courses  map[string]map[int]*CourseProgress
+}
+
+// Manager 运行注册表
+type Manager struct {
+	mu      sync.Mutex
+	seq     int
+	runs    map[string]*Run
+	journal *store.Journal
+	events  *hub.Hub
+}
+
+// NewManager 创建运行管理器, journal 为空时不持久化运行状态, events 为空时不发布事件
+func NewManager(journal *store.Journal, events *hub.Hub) *Manager {
+	return &Manager{
+		runs:    make(map[string]*Run),
+		journal: journal,
+		events:  events,
+	}
+}
+
+// StartRun 创建新的运行, 同一时间只允许一个运行处于进行中
+func (m *Manager) StartRun(users []string) (*Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkActive(); err != nil {
+		return nil, err
+	}
+
+	m.seq++
+	now := time.Now()
+	run := m.newRun(fmt.Sprintf("%s-%d", now.Format("20060102150405"), m.seq), now, users)
+	m.journal.RunStarted(run.ID, users)
+	m.events.Publish(hub.TypeRun, run.Info())
+	return run, nil
+}
+
+// Launch 创建运行并在后台处理所有用户的课程任务
+func (m *Manager) Launch(users []config.User) (*Run, error) {
+	var usernames []string
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+
+	run, err := m.StartRun(usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer run.Finish()
+
+		// 所有用户共享同一个协程池并发处理
+		run.Execute(users)
+	}()
+	return run, nil
+}
+
+// Resume 恢复上次进程退出时未结束的运行, 没有可恢复的运行时返回 nil
+// 仅恢复最近的一次运行, 更早的未结束运行标记为取消
+func (m *Manager) Resume() (*Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unfinished := m.journal.Unfinished()
+	if len(unfinished) == 0 {
+		return nil, nil
+	}
+	if err := m.checkActive(); err != nil {
+		return nil, err
+	}
+	for _, rec := range unfinished[:len(unfinished)-1] {
+		m.journal.RunFinished(rec.ID, string(RunCanceled))
+	}
+
+	rec := unfinished[len(unfinished)-1]
+	run := m.newRun(rec.ID, rec.CreatedAt, rec.Users)
+	run.resume = make(map[string]map[int]bool)
+	for user, courses := range rec.Courses {
+		run.resume[user] = make(map[int]bool)
+		for courseID, status := range courses {
+			if status != store.CourseDone {
+				run.resume[user][courseID] = true
+			}
+		}
+	}
+	m.events.Publish(hub.TypeRun, run.Info())
+	return run, nil
+}
+
+func (m *Manager) checkActive() error {
+	for _, run := range m.runs {
+		if run.State() == RunRunning {
+			return ErrRunActive
+		}
+	}
+	return nil
+}
+
+func (m *Manager) newRun(id string, createdAt time.Time, users []string) *Run {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &Run{
+		ID:        id,
+		CreatedAt: createdAt,
+		Users:     users,
+		ctx:       ctx,
+		cancel:    cancel,
+		journal:   m.journal,
+		events:    m.events,
+		limit:     config.Get().Global.Limit,
+		schedule:  config.Get().Global.Schedule,
+		state:     RunRunning,
+		progress:  make(map[string]map[int]UserCourseProgress),
+		courses:   make(map[string]map[int]*CourseProgress),
+	}
+	m.runs[run.ID] = run
+	return run
+}
+
+// Get 根据ID获取运行
+func (m *Manager) Get(id string) (*Run, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run, ok := m.runs[id]
+	return run, ok
+}
+
+// Latest 获取最近创建的运行
+func (m *Manager) Latest() *Run {
+	runs := m.List()
+	if len(runs) == 0 {
+		return nil
+	}
+	return runs[len(runs)-1]
+}
+
+// Active 获取正在进行中的运行
+func (m *Manager) Active() *Run {
+	for _, run := range m.List() {
+		if run.State() == RunRunning {
+			return run
+		}
+	}
+	return nil
+}
+
+// List 按创建时间排序返回所有运行
+func (m *Manager) List() []*Run {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := make([]*Run, 0, len(m.runs))
+	for _, run := range m.runs {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].CreatedAt.Equal(runs[j].CreatedAt) {
+			return runs[i].ID < runs[j].ID
+		}
+		return runs[i].CreatedAt.Before(runs[j].CreatedAt)
+	})
+	return runs
+}
+
+// Cancel 取消指定运行, 运行中的所有请求与等待都会随之中断
+func (m *Manager) Cancel(id string) error {
+	run, ok := m.Get(id)
+	if !ok {
+		return ErrRunNotFound
+	}
+	run.mu.Lock()
+	if run.state != RunRunning {
+		run.mu.Unlock()
+		return ErrRunFinished
+	}
+	run.state = RunCanceled
+	run.cancel()
+	run.mu.Unlock()
+
+	run.events.Publish(hub.TypeRun, run.Info())
+	return nil
+}
+
+// State 获取运行状态
+func (r *Run) State() RunState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+// Context 获取运行的上下文, 运行被取消时随之取消
+func (r *Run) Context() context.Context {
+	return r.ctx
+}
+
+// Canceled 运行是否已被取消
+func (r *Run) Canceled() bool {
+	return r.ctx.Err() != nil
+}
+
+// Finish 标记运行结束, 已取消的运行保持取消状态
+func (r *Run) Finish() {
+	r.mu.Lock()
+	if r.state == RunRunning {
+		r.state = RunCompleted
+	}
+	r.cancel()
+	r.journal.RunFinished(r.ID, string(r.state))
+	r.mu.Unlock()
+
+	r.events.Publish(hub.TypeRun, r.Info())
+}
+
+// Jobs 获取运行中的全部课程任务
+func (r *Run) Jobs() []Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]Task, len(r.jobs))
+	copy(jobs, r.jobs)
+	return jobs
+}
+
+// Info 获取运行概要
+func (r *Run) Info() RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RunInfo{
+		ID:        r.ID,
+		CreatedAt: r.CreatedAt,
+		Users:     append([]string{}, r.Users...),
+		State:     r.state,
+		Total:     len(r.jobs),
+		Completed: r.completed,
+	}
+}
+
+// GetProgress 获取当前运行的任务进度
+func (r *Run) GetProgress() (total int, completed int, percentage float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	total = len(r.jobs)
+	completed = r.completed
+
+	if total > 0 {
+		percentage = float64(completed) / float64(total) * 100
+	} else {
+		percentage = 0
+	}
+
+	return
+}
+
+// GetUserCourseProgress 获取当前运行中所有用户的课程进度数据
+func (r *Run) GetUserCourseProgress() map[string]map[int]UserCourseProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 创建一个副本以避免并发问题
+	result := make(map[string]map[int]UserCourseProgress)
+	for userID, courses := range r.progress {
+		result[userID] = make(map[int]UserCourseProgress)
+		for courseID, progress := range courses {
+			result[userID][courseID] = progress
+		}
+	}
+
+	return result
+}
+
+// addJobs 登记课程任务并初始化进度
+func (r *Run) addJobs(tasks []Task) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, task := range tasks {
+		r.jobs = append(r.jobs, task)
+		userID := task.User.Username
+		if _, exists := r.progress[userID]; !exists {
+			r.progress[userID] = make(map[int]UserCourseProgress)
+		}
+		r.progress[userID][task.Course.ID] = UserCourseProgress{
+			UserID:     userID,
+			CourseID:   task.Course.ID,
+			CourseName: task.Course.Name,
+			Progress:   0,
+			Status:     StatePending,
+		}
+		r.journal.CourseStatus(r.ID, userID, task.Course.ID, store.CourseQueued)
+	}
+}
+
+// setStatus 更新课程任务状态, progress 小于0时保持原进度
+func (r *Run) setStatus(task Task, status string, progress float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID := task.User.Username
+	if _, exists := r.progress[userID]; !exists {
+		r.progress[userID] = make(map[int]UserCourseProgress)
+	}
+	p, exists := r.progress[userID][task.Course.ID]
+	if !exists {
+		p = UserCourseProgress{
+			UserID:     userID,
+			CourseID:   task.Course.ID,
+			CourseName: task.Course.Name,
+		}
+	}
+	p.Status = status
+	if progress >= 0 {
+		p.Progress = progress
+	}
+	r.progress[userID][task.Course.ID] = p
+	r.setCourseState(task, status)
+	r.publishProgress(p)
+
+	switch status {
+	case StateCompleted:
+		r.journal.CourseStatus(r.ID, userID, task.Course.ID, store.CourseDone)
+	case StateFailed:
+		r.journal.CourseStatus(r.ID, userID, task.Course.ID, store.CourseFailed)
+	}
+}
+
+// Failed 获取失败的课程数, 获取课程失败的用户同样计入
+func (r *Run) Failed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := r.failures
+	for _, courses := range r.progress {
+		for _, progress := range courses {
+			if progress.Status == StateFailed {
+				failed++
+			}
+		}
+	}
+	return failed
+}
+
+// done 完成任务计数
+func (r *Run) done() {
+	r.mu.Lock()
+	r.completed++
+	r.mu.Unlock()
+}
+
+// ProgressEvent 课程进度更新事件
+type ProgressEvent struct {
+	RunID  string             `json:"run_id"`
+	Course UserCourseProgress `json:"course"`
+}
+
+// publishProgress 发布课程进度更新
+func (r *Run) publishProgress(p UserCourseProgress) {
+	r.events.Publish(hub.TypeProgress, ProgressEvent{RunID: r.ID, Course: p})
+}
@@ -0,0 +1,70 @@
+package task
+
+import (
+	"sort"
+
+	"github.com/aoaostar/mooc/pkg/platform"
+)
+
+// ManualItem 需要学生手动完成的节点, 如作业、考试与投票
+type ManualItem struct {
+	ChapterID   int                 `json:"chapter_id"`
+	ChapterName string              `json:"chapter_name"`
+	NodeID      int                 `json:"node_id"`
+	NodeName    string              `json:"node_name"`
+	Types       []platform.NodeType `json:"types"`
+	URL         string              `json:"url,omitempty"`
+}
+
+// CourseManual 课程中需要手动完成的节点
+type CourseManual struct {
+	CourseID   int          `json:"course_id"`
+	CourseName string       `json:"course_name"`
+	Items      []ManualItem `json:"items"`
+}
+
+// manualItems 找出章节中包含非视频内容的节点
+func manualItems(chapters []platform.Chapter) []ManualItem {
+	var items []ManualItem
+	for _, chapter := range chapters {
+		for _, node := range chapter.Nodes {
+			types := node.Manual()
+			if len(types) == 0 {
+				continue
+			}
+			items = append(items, ManualItem{
+				ChapterID:   chapter.ID,
+				ChapterName: chapter.Name,
+				NodeID:      node.ID,
+				NodeName:    node.Name,
+				Types:       types,
+				URL:         node.URL,
+			})
+		}
+	}
+	return items
+}
+
+// ManualWork 获取每个用户需要手动完成的节点, 仅包含已获取章节且存在此类节点的课程
+func (r *Run) ManualWork() map[string][]CourseManual {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make(map[string][]CourseManual)
+	for user, courses := range r.courses {
+		for _, course := range courses {
+			if len(course.Manual) == 0 {
+				continue
+			}
+			result[user] = append(result[user], CourseManual{
+				CourseID:   course.ID,
+				CourseName: course.Name,
+				Items:      append([]ManualItem(nil), course.Manual...),
+			})
+		}
+		sort.Slice(result[user], func(i, j int) bool {
+			return result[user][i].CourseID < result[user][j].CourseID
+		})
+	}
+	return result
+}
@@ -0,0 +1,191 @@
+package task
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+)
+
+// 计划中课程的处理方式
+const (
+	PlanStudy = "study" // 学习
+	PlanSkip  = "skip"  // 跳过
+)
+
+// Plan 运行计划, 只获取课程与章节, 不学习任何节点
+type Plan struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Schedule 课程调度策略, 课程按该策略排序
+	Schedule string     `json:"schedule"`
+	Users    []UserPlan `json:"users"`
+	// Estimate 按实时播放与协程数估算的学习时间
+	Estimate Estimate `json:"estimate"`
+}
+
+// UserPlan 单个用户的运行计划
+type UserPlan struct {
+	Username string `json:"username"`
+	// Error 登录或获取课程列表失败的原因
+	Error    string       `json:"error,omitempty"`
+	Courses  []CoursePlan `json:"courses"`
+	Estimate Estimate     `json:"estimate"`
+}
+
+// CoursePlan 单门课程的运行计划
+type CoursePlan struct {
+	CourseID   int    `json:"course_id"`
+	CourseName string `json:"course_name"`
+	// Action 处理方式, 见 Plan* 常量
+	Action string `json:"action"`
+	// Reason 跳过的原因
+	Reason string `json:"reason,omitempty"`
+	// Error 获取章节失败的原因
+	Error  string     `json:"error,omitempty"`
+	Window string     `json:"window"`
+	EndAt  *time.Time `json:"end_at,omitempty"`
+	// Chapters 章节数, Nodes 节点总数
+	Chapters int `json:"chapters"`
+	Nodes    int `json:"nodes"`
+	// VideoNodes 视频节点数, PendingNodes 其中尚未学完的节点数
+	VideoNodes   int `json:"video_nodes"`
+	PendingNodes int `json:"pending_nodes"`
+	// ManualNodes 包含作业、考试等需要手动完成内容的节点数
+	ManualNodes int `json:"manual_nodes"`
+	// LockedNodes 尚未解锁的节点数
+	LockedNodes int `json:"locked_nodes"`
+	// Remaining 尚未学完的视频时长, 单位秒
+	Remaining int `json:"remaining"`
+}
+
+// MakePlan 按当前配置为 users 生成运行计划
+// 与正式运行一样登录、获取课程与章节、按课程名称筛选并应用跳过规则, 但不会上报任何学时
+// 同时规划的用户数不超过 Global.Limit, ctx 取消后尚未完成的用户在 UserPlan.Error 中记录原因
+func MakePlan(ctx context.Context, users []config.User) Plan {
+	conf := config.Get().Global
+	schedule := conf.Schedule
+	if schedule == "" {
+		schedule = config.DefaultSchedule
+	}
+	limit := workers(conf.Limit)
+	now := time.Now()
+
+	plan := Plan{CreatedAt: now, Schedule: schedule, Users: make([]UserPlan, len(users))}
+	sem := make(chan struct{}, limit)
+	wg := sync.WaitGroup{}
+	for i, user := range users {
+		wg.Add(1)
+		go func(i int, user config.User) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			plan.Users[i] = planUser(ctx, user, schedule, now)
+		}(i, user)
+	}
+	wg.Wait()
+
+	progress := make(map[string][]CourseProgress)
+	limits := make(map[string]int)
+	for i, user := range users {
+		userPlan := plan.Users[i]
+		limits[user.Username] = userLimit(user, limit)
+		for _, course := range userPlan.Courses {
+			state := StatePending
+			if course.Action != PlanStudy {
+				state = StateSkipped
+			}
+			progress[user.Username] = append(progress[user.Username], CourseProgress{
+				State:     state,
+				Remaining: course.Remaining,
+				ETA:       course.Remaining,
+			})
+		}
+	}
+
+	estimates, estimate := estimateAll(progress, limits, limit, now)
+	for i := range plan.Users {
+		plan.Users[i].Estimate = estimates[plan.Users[i].Username]
+	}
+	plan.Estimate = estimate
+	return plan
+}
+
+// planUser 生成单个用户的运行计划, 课程按调度策略排序
+func planUser(ctx context.Context, user config.User, schedule string, now time.Time) UserPlan {
+	userPlan := UserPlan{Username: user.Username, Courses: []CoursePlan{}}
+	driver, tasks, err := collect(ctx, user)
+	if err != nil {
+		userPlan.Error = err.Error()
+		return userPlan
+	}
+
+	items := make([]*queued, 0, len(tasks))
+	plans := make(map[int]CoursePlan, len(tasks))
+	for i, task := range tasks {
+		course := planCourse(ctx, driver, task.Course, now)
+		plans[course.CourseID] = course
+		items = append(items, &queued{task: task, seq: i, remaining: course.Remaining})
+	}
+	less := newPolicy(schedule)
+	sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+	for _, item := range items {
+		userPlan.Courses = append(userPlan.Courses, plans[item.task.Course.ID])
+	}
+	return userPlan
+}
+
+// planCourse 生成单门课程的计划, 跳过规则与正式运行一致, 跳过的课程不获取章节
+func planCourse(ctx context.Context, driver platform.Driver, course platform.Course, now time.Time) CoursePlan {
+	plan := CoursePlan{
+		CourseID:   course.ID,
+		CourseName: course.Name,
+		Action:     PlanStudy,
+		Window:     courseWindow(course, now),
+	}
+	if !course.EndAt.IsZero() {
+		end := course.EndAt
+		plan.EndAt = &end
+	}
+
+	switch {
+	case course.Progress >= 1:
+		plan.Action, plan.Reason = PlanSkip, "课程已学完"
+	case plan.Window == WindowEnded:
+		plan.Action, plan.Reason = PlanSkip, "课程已结束"
+	case plan.Window == WindowNotStarted:
+		plan.Action, plan.Reason = PlanSkip, "课程尚未开课"
+	}
+	if plan.Action == PlanSkip {
+		return plan
+	}
+
+	chapters, err := driver.ListChapters(ctx, course)
+	if err != nil {
+		plan.Error = "获取章节失败: " + err.Error()
+		return plan
+	}
+	plan.Chapters = len(chapters)
+	for _, chapter := range chapters {
+		for _, node := range chapter.Nodes {
+			plan.Nodes++
+			if len(node.Manual()) > 0 {
+				plan.ManualNodes++
+			}
+			if node.Locked {
+				plan.LockedNodes++
+			}
+			if !node.Video {
+				continue
+			}
+			plan.VideoNodes++
+			if !node.Done {
+				plan.PendingNodes++
+				plan.Remaining += node.Duration
+			}
+		}
+	}
+	return plan
+}
@@ -0,0 +1,136 @@
+package task_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/task"
+	"github.com/aoaostar/mooc/pkg/yinghua/yinghuatest"
+)
+
+func TestMakePlan(t *testing.T) {
+	srv := newServer(t)
+	finished := yinghuatest.Course(1, "高等数学 (已学完)")
+	finished.Progress, finished.Progress1 = 1, "100%"
+	upcoming := yinghuatest.Course(2, "高等数学 (下学期)")
+	upcoming.StartDate = time.Now().Add(24 * time.Hour).Format("2006-01-02 15:04:05")
+	current := yinghuatest.Course(3, "高等数学")
+	current.EndDate = time.Now().AddDate(0, 0, 7).Format("2006-01-02")
+	srv.AddCourse(finished, yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+	srv.AddCourse(upcoming, yinghuatest.Chapter(20, "第一章", yinghuatest.VideoNode(200, "导论", 10)))
+	srv.AddCourse(current,
+		yinghuatest.Chapter(30, "第一章",
+			yinghuatest.VideoNode(300, "导论", 0),
+			yinghuatest.VideoNode(301, "极限", 90),
+			yinghuatest.WorkNode(302, "课后作业"),
+		),
+		yinghuatest.Chapter(31, "第二章",
+			yinghuatest.Lock(yinghuatest.VideoNode(310, "导数", 30), time.Now().Add(time.Hour)),
+		),
+	)
+	srv.AddCourse(yinghuatest.Course(4, "大学英语"), yinghuatest.Chapter(40, "Unit 1", yinghuatest.VideoNode(400, "Reading", 10)))
+
+	user := newUser(srv)
+	user.CourseNames = []string{"数学"}
+	plan := task.MakePlan(context.Background(), []config.User{user})
+
+	for _, path := range []string{"/api/node/study.json", "/api/node/video.json"} {
+		if n := srv.Requests(path); n != 0 {
+			t.Errorf("请求 %s %d 次, 期望 0", path, n)
+		}
+	}
+	if plan.Schedule != config.DefaultSchedule || len(plan.Users) != 1 {
+		t.Fatalf("计划 = %+v, 期望 1 个用户且使用默认调度策略", plan)
+	}
+	userPlan := plan.Users[0]
+	if userPlan.Error != "" || len(userPlan.Courses) != 3 {
+		t.Fatalf("用户计划 = %+v, 期望 3 门课程", userPlan)
+	}
+
+	// 按结课时间排序, 有结课时间的课程在前
+	course := userPlan.Courses[0]
+	want := task.CoursePlan{
+		CourseID:     3,
+		CourseName:   "高等数学",
+		Action:       task.PlanStudy,
+		Window:       task.WindowOpen,
+		EndAt:        course.EndAt,
+		Chapters:     2,
+		Nodes:        4,
+		VideoNodes:   3,
+		PendingNodes: 2,
+		ManualNodes:  1,
+		LockedNodes:  1,
+		Remaining:    120,
+	}
+	if course != want || course.EndAt == nil {
+		t.Errorf("课程计划 = %+v, 期望 %+v", course, want)
+	}
+	for i, reason := range map[int]string{1: "课程已学完", 2: "课程尚未开课"} {
+		if course := userPlan.Courses[i]; course.Action != task.PlanSkip || course.Reason != reason || course.Nodes != 0 {
+			t.Errorf("课程计划 = %+v, 期望跳过: %s", course, reason)
+		}
+	}
+	if n := srv.Requests("/api/course/chapter.json"); n != 1 {
+		t.Errorf("获取章节 %d 次, 期望仅获取需要学习的课程", n)
+	}
+	if userPlan.Estimate.Remaining != 120 || userPlan.Estimate.ETA != 120 || plan.Estimate.ETA != 120 {
+		t.Errorf("估算 = %+v / %+v, 期望 120 秒", userPlan.Estimate, plan.Estimate)
+	}
+}
+
+func TestMakePlanLoginFailure(t *testing.T) {
+	srv := newServer(t)
+	user := newUser(srv)
+	user.Password = "wrong"
+
+	plan := task.MakePlan(context.Background(), []config.User{user})
+
+	if len(plan.Users) != 1 || plan.Users[0].Error == "" || len(plan.Users[0].Courses) != 0 {
+		t.Errorf("计划 = %+v, 期望记录登录失败", plan)
+	}
+}
+
+func TestMakePlanKeepsUserOrder(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+	var users []config.User
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		srv.AddUser(name, "secret")
+		user := newUser(srv)
+		user.Username = name
+		users = append(users, user)
+	}
+
+	plan := task.MakePlan(context.Background(), users)
+
+	if len(plan.Users) != len(users) {
+		t.Fatalf("用户数 = %d, 期望 %d", len(plan.Users), len(users))
+	}
+	for i, userPlan := range plan.Users {
+		if userPlan.Username != users[i].Username || userPlan.Error != "" || len(userPlan.Courses) != 1 {
+			t.Errorf("第 %d 个用户计划 = %+v, 期望 %s 的 1 门课程", i, userPlan, users[i].Username)
+		}
+	}
+	if plan.Estimate.Remaining != 40 {
+		t.Errorf("剩余时长 = %d, 期望 40", plan.Estimate.Remaining)
+	}
+}
+
+func TestMakePlanStopsWhenCanceled(t *testing.T) {
+	srv := newServer(t)
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", 10)))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	plan := task.MakePlan(ctx, []config.User{newUser(srv)})
+
+	if len(plan.Users) != 1 || plan.Users[0].Error == "" {
+		t.Errorf("计划 = %+v, 期望记录取消原因", plan)
+	}
+	if n := srv.Requests("/api/course/chapter.json"); n != 0 {
+		t.Errorf("获取章节 %d 次, 期望 0", n)
+	}
+}
@@ -0,0 +1,355 @@
+package task
+
+import (
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/platform"
+)
+
+// 节点与课程状态
+const (
+	StatePending    = "pending"
+	StateInProgress = "in_progress"
+	StateCompleted  = "completed"
+	StateFailed     = "failed"
+	// StateWaiting 等待节点解锁
+	StateWaiting = "waiting"
+	// StateSkipped 课程尚未开课, 本次运行跳过
+	StateSkipped = "skipped"
+)
+
+// NodeProgress 节点进度
+type NodeProgress struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Duration  int       `json:"duration"` // 视频时长, 单位秒
+	Percent   float64   `json:"percent"`
+	State     string    `json:"state"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Remaining 剩余视频时长, 单位秒
+	Remaining int `json:"remaining"`
+	// WaitUntil 节点未解锁时的解锁时间
+	WaitUntil *time.Time `json:"wait_until,omitempty"`
+
+	// reported 本次运行已上报过进度, 之后的进度变化才计入学习速度
+	reported bool
+}
+
+// ChapterProgress 章节进度
+type ChapterProgress struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name"`
+	Percent   float64        `json:"percent"`
+	State     string         `json:"state"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Remaining int            `json:"remaining"`
+	Nodes     []NodeProgress `json:"nodes"`
+}
+
+// CourseProgress 课程进度
+type CourseProgress struct {
+	ID        int               `json:"id"`
+	Name      string            `json:"name"`
+	Duration  int               `json:"duration"`
+	Percent   float64           `json:"percent"`
+	State     string            `json:"state"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Chapters  []ChapterProgress `json:"chapters"`
+	// Manual 未自动学习, 需要手动完成的节点
+	Manual []ManualItem `json:"manual"`
+	// EndAt 结课时间, 未知时为空
+	EndAt *time.Time `json:"end_at,omitempty"`
+	// Remaining 剩余视频时长, 单位秒
+	Remaining int `json:"remaining"`
+	// Speed 观察到的学习速度, 每秒学习的视频秒数, 尚未观察到时为0
+	Speed float64 `json:"speed"`
+	// ETA 按学习速度估算的剩余学习时间, 单位秒
+	ETA int `json:"eta"`
+	// FinishAt 预计学完的时间, 课程结束后为空
+	FinishAt *time.Time `json:"finish_at,omitempty"`
+	// Warning 按剩余学习时间可能无法在结课前学完时的提示
+	Warning string `json:"warning,omitempty"`
+
+	// studied 与 elapsed 为连续两次进度之间学习的视频秒数与实际耗时, 用于计算学习速度
+	studied float64
+	elapsed time.Duration
+}
+
+// ProgressTree 运行的完整进度, 用户 -> 课程 -> 章节 -> 节点
+type ProgressTree struct {
+	RunID string                      `json:"run_id"`
+	State RunState                    `json:"state"`
+	Users map[string][]CourseProgress `json:"users"`
+	// Estimates 每个用户的剩余时间估算
+	Estimates map[string]Estimate `json:"estimates"`
+	// Estimate 整个运行的剩余时间估算
+	Estimate Estimate `json:"estimate"`
+}
+
+// newCourseProgress 根据章节列表构建课程进度, 仅统计视频节点, 其他节点记录在 Manual 中
+func newCourseProgress(course platform.Course, chapters []platform.Chapter) *CourseProgress {
+	now := time.Now()
+	cp := &CourseProgress{
+		ID:        course.ID,
+		Name:      course.Name,
+		State:     StateInProgress,
+		UpdatedAt: now,
+		Manual:    manualItems(chapters),
+	}
+	if !course.EndAt.IsZero() {
+		end := course.EndAt
+		cp.EndAt = &end
+	}
+	for _, chapter := range chapters {
+		ch := ChapterProgress{
+			ID:        chapter.ID,
+			Name:      chapter.Name,
+			State:     StatePending,
+			UpdatedAt: now,
+		}
+		for _, node := range chapter.Nodes {
+			if !node.Video {
+				continue
+			}
+			np := NodeProgress{
+				ID:        node.ID,
+				Name:      node.Name,
+				Duration:  node.Duration,
+				State:     StatePending,
+				UpdatedAt: now,
+			}
+			if node.Done {
+				np.Percent, np.State = 100, StateCompleted
+			}
+			ch.Nodes = append(ch.Nodes, np)
+		}
+		cp.Chapters = append(cp.Chapters, ch)
+	}
+	cp.refresh()
+	return cp
+}
+
+// apply 合并节点事件
+func (c *CourseProgress) apply(ev event) {
+	now := time.Now()
+	for ci := range c.Chapters {
+		chapter := &c.Chapters[ci]
+		if chapter.ID != ev.Chapter.ID {
+			continue
+		}
+		for ni := range chapter.Nodes {
+			node := &chapter.Nodes[ni]
+			if node.ID != ev.Node.ID {
+				continue
+			}
+			node.WaitUntil = nil
+			if ev.Duration > 0 {
+				node.Duration = ev.Duration
+			}
+			switch ev.Type {
+			case eventNodeWaiting:
+				until := ev.Until
+				node.State, node.WaitUntil = StateWaiting, &until
+			case eventNodeStart:
+				node.State = StateInProgress
+			case eventNodeProgress:
+				c.observe(node, ev.Progress, now)
+				node.State, node.reported = StateInProgress, true
+				node.Percent = ev.Progress
+			case eventNodeDone:
+				node.State = StateCompleted
+				node.Percent = 100
+			case eventNodeFailed:
+				node.State = StateFailed
+			}
+			node.UpdatedAt = now
+			chapter.UpdatedAt = now
+		}
+	}
+	c.UpdatedAt = now
+	c.refresh()
+}
+
+// sync 将平台上已完成的节点标记为完成
+func (c *CourseProgress) sync(chapters []platform.Chapter) {
+	now := time.Now()
+	done := make(map[int]bool)
+	for _, chapter := range chapters {
+		for _, node := range chapter.Nodes {
+			if node.Video && node.Done {
+				done[node.ID] = true
+			}
+		}
+	}
+	for ci := range c.Chapters {
+		for ni := range c.Chapters[ci].Nodes {
+			node := &c.Chapters[ci].Nodes[ni]
+			if done[node.ID] && node.State != StateCompleted {
+				node.Percent, node.State, node.UpdatedAt = 100, StateCompleted, now
+			}
+		}
+	}
+	c.UpdatedAt = now
+	c.refresh()
+}
+
+// nodeCompleted 节点在本次运行的进度中是否已完成
+func (r *Run) nodeCompleted(task Task, chapterID int, nodeID int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp, ok := r.courses[task.User.Username][task.Course.ID]
+	if !ok {
+		return false
+	}
+	for _, chapter := range cp.Chapters {
+		if chapter.ID != chapterID {
+			continue
+		}
+		for _, node := range chapter.Nodes {
+			if node.ID == nodeID {
+				return node.State == StateCompleted
+			}
+		}
+	}
+	return false
+}
+
+// refresh 重新汇总章节与课程的时长、百分比、剩余时长和状态
+func (c *CourseProgress) refresh() {
+	var courseDone, courseTotal float64
+	c.Duration, c.Remaining = 0, 0
+	for ci := range c.Chapters {
+		chapter := &c.Chapters[ci]
+		var done, total float64
+		started, finished := false, true
+		chapter.Remaining = 0
+		for ni := range chapter.Nodes {
+			node := &chapter.Nodes[ni]
+			weight := float64(node.Duration)
+			if weight <= 0 {
+				weight = 1
+			}
+			done += weight * node.Percent / 100
+			total += weight
+			c.Duration += node.Duration
+			node.Remaining = remaining(*node)
+			chapter.Remaining += node.Remaining
+			if node.State != StatePending {
+				started = true
+			}
+			if node.State != StateCompleted {
+				finished = false
+			}
+		}
+		chapter.Percent = percent(done, total)
+		switch {
+		case finished:
+			chapter.State = StateCompleted
+		case started:
+			chapter.State = StateInProgress
+		default:
+			chapter.State = StatePending
+		}
+		courseDone += done
+		courseTotal += total
+		c.Remaining += chapter.Remaining
+	}
+	c.Percent = percent(courseDone, courseTotal)
+	c.Speed = c.speed()
+	c.ETA = eta(c.Remaining, c.Speed)
+	c.Warning = ""
+	if c.EndAt != nil {
+		c.Warning = deadlineWarning(*c.EndAt, c.ETA, time.Now())
+	}
+}
+
+func percent(done, total float64) float64 {
+	if total <= 0 {
+		return 100
+	}
+	return done / total * 100
+}
+
+// track 处理课程任务产生的进度事件
+func (r *Run) track(task Task, ev event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID := task.User.Username
+	if r.courses[userID] == nil {
+		r.courses[userID] = make(map[int]*CourseProgress)
+	}
+	if ev.Type == eventChapters {
+		// 课程重新排队时保留已有的进度与学习速度, 只同步平台上已完成的节点
+		if cp, ok := r.courses[userID][task.Course.ID]; ok && len(cp.Chapters) > 0 {
+			cp.sync(ev.Chapters)
+		} else {
+			r.courses[userID][task.Course.ID] = newCourseProgress(task.Course, ev.Chapters)
+		}
+	} else if cp, ok := r.courses[userID][task.Course.ID]; ok {
+		cp.apply(ev)
+	}
+
+	// 同步课程整体百分比, 兼容旧的进度接口
+	if cp, ok := r.courses[userID][task.Course.ID]; ok {
+		if p, ok := r.progress[userID][task.Course.ID]; ok {
+			p.Progress = cp.Percent
+			p.ETA = cp.ETA
+			p.Warning = cp.Warning
+			r.progress[userID][task.Course.ID] = p
+			r.publishProgress(p)
+		}
+	}
+}
+
+// setCourseState 同步课程进度树中的课程状态, 调用方需持有 r.mu
+func (r *Run) setCourseState(task Task, state string) {
+	cp, ok := r.courses[task.User.Username][task.Course.ID]
+	if !ok {
+		cp = &CourseProgress{ID: task.Course.ID, Name: task.Course.Name}
+		if r.courses[task.User.Username] == nil {
+			r.courses[task.User.Username] = make(map[int]*CourseProgress)
+		}
+		r.courses[task.User.Username][task.Course.ID] = cp
+	}
+	cp.State = state
+	cp.UpdatedAt = time.Now()
+	if state == StateCompleted && len(cp.Chapters) == 0 {
+		cp.Percent = 100
+	}
+}
+
+// GetProgressTree 获取运行的完整进度树
+func (r *Run) GetProgressTree() ProgressTree {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	tree := ProgressTree{
+		RunID: r.ID,
+		State: r.state,
+		Users: make(map[string][]CourseProgress),
+	}
+	for _, job := range r.jobs {
+		userID := job.User.Username
+		course := CourseProgress{
+			ID:    job.Course.ID,
+			Name:  job.Course.Name,
+			State: StatePending,
+		}
+		if cp, ok := r.courses[userID][job.Course.ID]; ok {
+			course = *cp
+			course.Chapters = make([]ChapterProgress, len(cp.Chapters))
+			for i, chapter := range cp.Chapters {
+				course.Chapters[i] = chapter
+				course.Chapters[i].Nodes = append([]NodeProgress(nil), chapter.Nodes...)
+			}
+		}
+		if unfinished(course.State) {
+			course.FinishAt = finishAt(course.ETA, now)
+		}
+		tree.Users[userID] = append(tree.Users[userID], course)
+	}
+	tree.Estimates, tree.Estimate = r.estimates(tree.Users, now)
+	return tree
+}
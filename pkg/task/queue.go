@@ -0,0 +1,229 @@
+package task
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+)
+
+// queued 排队中的课程任务
+type queued struct {
+	task Task
+	// seq 入队顺序, 优先级相同时先入队的先学习
+	seq int
+	// remaining 剩余视频时长, 单位秒, 未知时为 -1
+	remaining int
+}
+
+// policy 课程调度策略, 返回 a 是否应先于 b 学习
+type policy func(a, b *queued) bool
+
+// newPolicy 根据配置中的调度策略名称创建调度策略, 未知的名称按结课时间调度
+func newPolicy(name string) policy {
+	var less policy
+	switch name {
+	case config.ScheduleFIFO:
+		return func(a, b *queued) bool { return a.seq < b.seq }
+	case config.ScheduleProgress:
+		less = func(a, b *queued) bool { return a.task.Course.Progress < b.task.Course.Progress }
+	case config.ScheduleDuration:
+		less = func(a, b *queued) bool { return earlier(a.remaining, b.remaining) }
+	default:
+		less = func(a, b *queued) bool { return endsBefore(a.task.Course, b.task.Course) }
+	}
+	return func(a, b *queued) bool {
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.seq < b.seq
+	}
+}
+
+// earlier 比较两个剩余时长, 未知 (小于0) 的排在最后
+func earlier(a, b int) bool {
+	if a < 0 || b < 0 {
+		return a >= 0 && b < 0
+	}
+	return a < b
+}
+
+// queueHeap 按调度策略排序的小顶堆
+type queueHeap struct {
+	items []*queued
+	less  policy
+}
+
+func (h *queueHeap) Len() int           { return len(h.items) }
+func (h *queueHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h *queueHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *queueHeap) Push(x interface{}) { h.items = append(h.items, x.(*queued)) }
+func (h *queueHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// queue 运行内所有用户共享的课程优先队列, 协程从中取出优先级最高且用户名额未满的课程
+type queue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	heap queueHeap
+	seq  int
+	// limits 每个用户同时学习的课程数上限, running 为当前学习中的课程数
+	limits  map[string]int
+	running map[string]int
+	// pending 尚未结束的课程数, 包括排队、学习中与等待节点解锁的课程
+	pending int
+	// producers 尚未投递完课程的用户数
+	producers int
+	closed    bool
+}
+
+func newQueue(less policy, producers int) *queue {
+	q := &queue{
+		heap:      queueHeap{less: less},
+		limits:    make(map[string]int),
+		running:   make(map[string]int),
+		producers: producers,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// add 投递用户的课程, remaining 为已知的课程剩余视频时长
+func (q *queue) add(tasks []Task, limit int, remaining map[int]int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, task := range tasks {
+		item := &queued{task: task, seq: q.seq, remaining: -1}
+		if seconds, ok := remaining[task.Course.ID]; ok {
+			item.remaining = seconds
+		}
+		q.seq++
+		q.limits[task.User.Username] = limit
+		q.pending++
+		heap.Push(&q.heap, item)
+	}
+	q.cond.Broadcast()
+}
+
+// produced 一个用户的课程投递完成
+func (q *queue) produced() {
+	q.mu.Lock()
+	q.producers--
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// pop 阻塞直到取出可以学习的课程, 全部课程结束或队列关闭时返回 false
+func (q *queue) pop() (*queued, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return nil, false
+		}
+		if item := q.next(); item != nil {
+			q.running[item.task.User.Username]++
+			return item, true
+		}
+		if q.pending == 0 && q.producers == 0 {
+			return nil, false
+		}
+		q.cond.Wait()
+	}
+}
+
+// next 取出优先级最高且用户名额未满的课程, 调用方需持有 q.mu
+func (q *queue) next() *queued {
+	var skipped []*queued
+	defer func() {
+		for _, item := range skipped {
+			heap.Push(&q.heap, item)
+		}
+	}()
+	for q.heap.Len() > 0 {
+		item := heap.Pop(&q.heap).(*queued)
+		user := item.task.User.Username
+		if q.running[user] < q.limits[user] {
+			return item
+		}
+		skipped = append(skipped, item)
+	}
+	return nil
+}
+
+// requeue 等待解锁的课程重新排队
+func (q *queue) requeue(item *queued) {
+	q.mu.Lock()
+	heap.Push(&q.heap, item)
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// release 释放课程占用的用户名额
+func (q *queue) release(item *queued) {
+	q.mu.Lock()
+	q.running[item.task.User.Username]--
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// finish 课程结束, 不再排队
+func (q *queue) finish() {
+	q.mu.Lock()
+	q.pending--
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// close 关闭队列, 等待中的协程立即返回
+func (q *queue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// drain 取出队列中剩余的课程, 用于运行取消后结束仍在排队的课程
+func (q *queue) drain() []*queued {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := q.heap.items
+	q.heap.items = nil
+	q.pending -= len(items)
+	return items
+}
+
+// measure 使用获取课程时已登录的驱动获取课程的剩余视频时长, 用于按剩余时长调度, 获取失败的课程视为未知
+func measure(ctx context.Context, driver platform.Driver, tasks []Task) map[int]int {
+	remaining := make(map[int]int)
+	for _, task := range tasks {
+		if task.Course.Progress >= 1 || task.Course.Ended {
+			remaining[task.Course.ID] = 0
+			continue
+		}
+		chapters, err := driver.ListChapters(ctx, task.Course)
+		if err != nil {
+			continue
+		}
+		seconds := 0
+		for _, chapter := range chapters {
+			for _, node := range chapter.Nodes {
+				if node.Video && !node.Done {
+					seconds += node.Duration
+				}
+			}
+		}
+		remaining[task.Course.ID] = seconds
+	}
+	return remaining
+}
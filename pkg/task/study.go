@@ -0,0 +1,177 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/store"
+	"github.com/aoaostar/mooc/pkg/util"
+	"github.com/sirupsen/logrus"
+)
+
+// eventType 学习事件类型
+type eventType string
+
+const (
+	eventChapters     eventType = "chapters"      // 已获取课程章节
+	eventNodeStart    eventType = "node_start"    // 开始学习节点
+	eventNodeProgress eventType = "node_progress" // 节点进度更新
+	eventNodeDone     eventType = "node_done"     // 节点学习完成
+	eventNodeFailed   eventType = "node_failed"   // 节点学习失败
+	eventNodeWaiting  eventType = "node_waiting"  // 节点未解锁, 等待解锁
+)
+
+// event 学习过程中产生的进度事件
+type event struct {
+	Type     eventType
+	Chapters []platform.Chapter // 仅 eventChapters
+	Chapter  platform.Chapter
+	Node     platform.Node
+	Progress float64   // 节点进度 0-100
+	Duration int       // 节点视频时长, 单位秒, 未知时为0
+	Until    time.Time // 仅 eventNodeWaiting, 节点解锁时间
+}
+
+// studyCourse 按章节顺序学习课程中的全部视频节点, 仅在上下文取消、登录失效或获取章节失败时返回错误
+// 尚未到解锁时间的节点跳过, wakeAt 返回其中最早的解锁时间, 全部节点处理完毕时为零值
+func (r *Run) studyCourse(ctx context.Context, driver platform.Driver, task Task) (wakeAt time.Time, err error) {
+	course := task.Course
+	output(task, fmt.Sprintf("开始学习课程: [%s][courseId=%d]", course.Name, course.ID))
+	chapters, err := driver.ListChapters(ctx, course)
+	if err != nil {
+		outputWith(task, fmt.Sprintf("获取课程章节失败: %s", err.Error()), logrus.Errorf)
+		return time.Time{}, err
+	}
+	r.track(task, event{Type: eventChapters, Chapters: chapters})
+	if warning := r.warning(task); warning != "" {
+		outputWith(task, fmt.Sprintf("课程: [%s] %s", course.Name, warning), logrus.Warnf)
+	}
+	if items := manualItems(chapters); len(items) > 0 {
+		output(task, fmt.Sprintf("课程: [%s] 有 %d 个节点包含作业、考试等内容, 需要手动完成", course.Name, len(items)))
+	}
+
+	for _, chapter := range chapters {
+		output(task, fmt.Sprintf("课程: [%s] 当前第 %d 章, [%s][chapterId=%d]", course.Name, chapter.Index, chapter.Name, chapter.ID))
+		for _, node := range chapter.Nodes {
+			// 非视频节点记录在 Manual 中, 由学生手动完成
+			if !node.Video {
+				continue
+			}
+			// 平台显示已完成或本次运行已学完的节点不再学习, 课程重新排队时同样跳过
+			if node.Done || r.nodeCompleted(task, chapter.ID, node.ID) {
+				continue
+			}
+			if until, ok := lockedUntil(node, time.Now()); ok {
+				output(task, fmt.Sprintf("课程: [%s] 章节: [%s] %s[nodeId=%d] 未解锁, 等待至 %s", course.Name, chapter.Name, node.Name, node.ID, until.Format("2006-01-02 15:04:05")))
+				r.track(task, event{Type: eventNodeWaiting, Chapter: chapter, Node: node, Until: until})
+				if wakeAt.IsZero() || until.Before(wakeAt) {
+					wakeAt = until
+				}
+				continue
+			}
+			if err := r.studyNode(ctx, driver, task, chapter, node); err != nil {
+				return time.Time{}, err
+			}
+		}
+	}
+
+	if !wakeAt.IsZero() {
+		return wakeAt, nil
+	}
+	output(task, fmt.Sprintf("课程学习完成: [%s][courseId=%d]", course.Name, course.ID))
+	return time.Time{}, nil
+}
+
+// lockedUntil 节点未解锁且解锁时间在 now 之后时返回解锁时间
+// 解锁时间未知或已过的节点直接尝试学习, 由平台判断是否可以学习
+func lockedUntil(node platform.Node, now time.Time) (time.Time, bool) {
+	if !node.Locked || !node.UnlockAt.After(now) {
+		return time.Time{}, false
+	}
+	return node.UnlockAt, true
+}
+
+// studyNode 学习单个节点并记录断点, 节点失败时跳过, 仅在上下文取消或登录失效时返回错误
+func (r *Run) studyNode(ctx context.Context, driver platform.Driver, task Task, chapter platform.Chapter, node platform.Node) error {
+	course := task.Course
+	points := &checkpoints{run: r, user: task.User.Username}
+	ev := event{Chapter: chapter, Node: node}
+
+	checkpoint, _ := points.Load(course.ID, node.ID)
+	if checkpoint.Done {
+		// 节点完成与否以平台为准, 断点记录已完成但平台显示未完成时从头学习
+		outputWith(task, fmt.Sprintf("课程: [%s] 章节: [%s] %s[nodeId=%d] 上次运行记录已完成, 但平台显示未完成, 重新学习", course.Name, chapter.Name, node.Name, node.ID), logrus.Warnf)
+		checkpoint = platform.Checkpoint{}
+	}
+	if checkpoint.StudyTime < 1 {
+		checkpoint = platform.Checkpoint{}
+	}
+	ev.Type = eventNodeStart
+	r.track(task, ev)
+
+	err := driver.StudyNode(ctx, platform.Study{
+		Course:     course,
+		Chapter:    chapter,
+		Node:       node,
+		Checkpoint: checkpoint,
+		OnProgress: func(progress platform.NodeProgress, last platform.Checkpoint) {
+			checkpoint = last
+			points.Save(course.ID, node.ID, checkpoint)
+			ev.Type, ev.Progress, ev.Duration = eventNodeProgress, progress.Percent, progress.Duration
+			r.track(task, ev)
+		},
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		outputWith(task, fmt.Sprintf("课程: [%s] 章节: [%s] %s[nodeId=%d], %s", course.Name, chapter.Name, node.Name, node.ID, err.Error()), logrus.Errorf)
+		ev.Type = eventNodeFailed
+		r.track(task, ev)
+		// 登录失效时后续节点同样无法学习, 结束当前课程
+		if errors.Is(err, platform.ErrAuth) || errors.Is(err, platform.ErrTokenExpired) {
+			return err
+		}
+		return nil
+	}
+
+	checkpoint.Done = true
+	points.Save(course.ID, node.ID, checkpoint)
+	ev.Type, ev.Progress = eventNodeDone, 100
+	r.track(task, ev)
+	return nil
+}
+
+func output(task Task, message string) {
+	outputWith(task, message, logrus.Infof)
+}
+
+func outputWith(task Task, message string, writer func(format string, args ...interface{})) {
+	util.Output(task.User.Username, message, writer)
+}
+
+// checkpoints 将节点断点写入运行日志
+type checkpoints struct {
+	run  *Run
+	user string
+}
+
+// Load 获取本次运行记录的节点断点, 其他运行的断点不会使用
+func (c *checkpoints) Load(courseID int, nodeID int) (platform.Checkpoint, bool) {
+	node, ok := c.run.journal.Node(c.run.ID, c.user, courseID, nodeID)
+	if !ok {
+		return platform.Checkpoint{}, false
+	}
+	return platform.Checkpoint{StudyID: node.StudyID, StudyTime: node.StudyTime, Done: node.Done}, true
+}
+
+func (c *checkpoints) Save(courseID int, nodeID int, checkpoint platform.Checkpoint) {
+	c.run.journal.SaveNode(c.run.ID, c.user, courseID, nodeID, store.NodeRecord{
+		StudyID:   checkpoint.StudyID,
+		StudyTime: checkpoint.StudyTime,
+		Done:      checkpoint.Done,
+	})
+}
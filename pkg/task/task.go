@@ -2,13 +2,12 @@ package task
 
 import (
 	"fmt"
-	"math"
-	"os"
 	"sync"
+	"time"
 
 	"github.com/aoaostar/mooc/pkg/config"
-	"github.com/aoaostar/mooc/pkg/yinghua"
-	"github.com/aoaostar/mooc/pkg/yinghua/types"
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/util"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,241 +17,250 @@ type UserCourseProgress struct {
 	CourseID   int     // 课程ID
 	CourseName string  // 课程名称
 	Progress   float64 // 0-100 的百分比
-	Status     string  // "pending", "in_progress", "completed", "failed"
+	Status     string  // "pending", "in_progress", "waiting", "skipped", "completed", "failed"
+	ETA        int     // 预计剩余学习时间, 单位秒
+	Warning    string  // 可能无法在结课前学完时的提示
 }
 
-// 进度跟踪变量
-var (
-	progress struct {
-		Total     int
-		Completed int
-		mu        sync.Mutex
-	}
-
-	// 使用映射存储每个用户的课程进度
-	UserProgressMap = struct {
-		data map[string]map[int]UserCourseProgress
-		mu   sync.Mutex
-	}{
-		data: make(map[string]map[int]UserCourseProgress),
-	}
-)
-
 type Task struct {
 	User   config.User
-	Course types.CoursesList
+	Course platform.Course
 	Status bool
 }
 
-var Tasks []Task
-
-func Start() {
-	// 检查是否有停止标记，如果有则删除
-	stopFile := "./stop_flag"
-	if _, err := os.Stat(stopFile); err == nil {
-		if err := os.Remove(stopFile); err != nil {
-			logrus.Error("删除停止标记文件失败: ", err)
-		}
+// Execute 并发处理所有用户的课程任务, 阻塞直到全部完成
+// 所有用户的课程按调度策略进入同一个优先队列, 运行开始时 Global.Limit 个协程从队列中取出课程学习,
+// 单个用户同时进行的课程数不超过 User.Limit
+func (r *Run) Execute(users []config.User) {
+	limit := workers(r.limit)
+	schedule := r.schedule
+	if schedule == "" {
+		schedule = config.DefaultSchedule
 	}
+	q := newQueue(newPolicy(schedule), len(users))
 
-	// 初始化进度跟踪
-	progress.mu.Lock()
-	progress.Total = len(Tasks)
-	progress.Completed = 0
-	progress.mu.Unlock()
+	logrus.Infof("任务系统启动成功, 协程数: %d, 用户数: %d, 调度策略: %s", limit, len(users), schedule)
 
-	// 初始化用户课程进度映射
-	UserProgressMap.mu.Lock()
-	UserProgressMap.data = make(map[string]map[int]UserCourseProgress)
-	for _, task := range Tasks {
-		userID := task.User.Username
-		if _, exists := UserProgressMap.data[userID]; !exists {
-			UserProgressMap.data[userID] = make(map[int]UserCourseProgress)
-		}
-		UserProgressMap.data[userID][task.Course.ID] = UserCourseProgress{
-			UserID:     userID,
-			CourseID:   task.Course.ID,
-			CourseName: task.Course.Name,
-			Progress:   0,
-			Status:     "pending",
-		}
-	}
-	UserProgressMap.mu.Unlock()
-
-	limit := int(math.Min(float64(config.Conf.Global.Limit), float64(len(Tasks))))
-	jobs := make(chan Task, limit)
 	wg := sync.WaitGroup{}
+	for _, user := range users {
+		wg.Add(1)
+		go func(user config.User) {
+			defer wg.Done()
+			defer q.produced()
+			r.executeUser(user, q, limit, schedule)
+		}(user)
+	}
 	for i := 0; i < limit; i++ {
+		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for job := range jobs {
-				work(job)
-				// 更新完成任务数
-				progress.mu.Lock()
-				progress.Completed++
-				progress.mu.Unlock()
-			}
+			r.worker(q, &wg)
 		}()
-		wg.Add(1)
 	}
 
-	logrus.Infof("任务系统启动成功, 协程数: %d, 任务数: %d", limit, len(Tasks))
+	// 运行取消时关闭队列, 唤醒等待中的协程
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			q.close()
+		case <-stop:
+		}
+	}()
+	wg.Wait()
+	close(stop)
 
-	for _, task := range Tasks {
-		jobs <- task
+	if r.Canceled() {
+		// 仍在排队的课程不会再被取出, 与学习中的课程一样按取消处理
+		for _, item := range q.drain() {
+			r.cancelCourse(item.task)
+		}
+		logrus.Infof("运行[%s]已取消", r.ID)
+		return
 	}
-	close(jobs)
-	wg.Wait()
-	logrus.Infof("恭喜您, 所有任务都已全部完成~~~ %d", len(Tasks))
+	total, _, _ := r.GetProgress()
+	logrus.Infof("恭喜您, 所有任务都已全部完成~~~ %d", total)
 }
 
-// 检查是否存在停止标记
-func checkStopFlag() bool {
-	stopFile := "./stop_flag"
-	_, err := os.Stat(stopFile)
-	return err == nil
+// executeUser 获取单个用户的课程并投递到优先队列
+func (r *Run) executeUser(user config.User, q *queue, limit int, schedule string) {
+	driver, tasks, err := collect(r.ctx, user)
+	if err != nil {
+		if !r.Canceled() {
+			logrus.Error(err)
+			r.mu.Lock()
+			r.failures++
+			r.mu.Unlock()
+		}
+		return
+	}
+	tasks = r.resumable(user, tasks)
+	if len(tasks) == 0 {
+		logrus.Warn(fmt.Sprintf("用户 %s 没有找到可添加的任务", user.Username))
+		return
+	}
+	r.addJobs(tasks)
+
+	var remaining map[int]int
+	if schedule == config.ScheduleDuration {
+		remaining = measure(r.ctx, driver, tasks)
+	}
+
+	q.add(tasks, userLimit(user, limit), remaining)
 }
 
-// GetProgress 获取当前任务进度
-func GetProgress() (total int, completed int, percentage float64) {
-	progress.mu.Lock()
-	defer progress.mu.Unlock()
+// workers 全局协程数, 至少为1
+func workers(limit int) int {
+	if limit < 1 {
+		return 1
+	}
+	return limit
+}
 
-	total = progress.Total
-	completed = progress.Completed
+// userLimit 用户同时学习的课程数, 未配置或超过全局协程数时使用全局协程数
+func userLimit(user config.User, workers int) int {
+	if user.Limit < 1 || user.Limit > workers {
+		return workers
+	}
+	return user.Limit
+}
 
-	if total > 0 {
-		percentage = float64(completed) / float64(total) * 100
-	} else {
-		percentage = 0
+// worker 不断从队列中取出课程学习, 直到全部课程结束或运行取消
+// 课程存在未解锁的节点时释放名额, 等到解锁时间后重新排队
+func (r *Run) worker(q *queue, wg *sync.WaitGroup) {
+	for {
+		// 运行取消后不再取出课程, 剩余的课程由 Execute 统一结束
+		if r.Canceled() {
+			return
+		}
+		item, ok := q.pop()
+		if !ok {
+			return
+		}
+		wakeAt := r.work(item.task)
+		q.release(item)
+		if wakeAt.IsZero() {
+			q.finish()
+			// 更新完成任务数
+			r.done()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.wait(q, item, wakeAt)
+		}()
 	}
+}
 
-	return
+// wait 等到解锁时间后课程重新排队
+func (r *Run) wait(q *queue, item *queued, wakeAt time.Time) {
+	if util.Sleep(r.ctx, time.Until(wakeAt)) == nil {
+		q.requeue(item)
+		return
+	}
+	r.cancelCourse(item.task)
+	q.finish()
 }
 
-func work(task Task) {
-	userID := task.User.Username
-	courseID := task.Course.ID
+// cancelCourse 运行取消时结束尚未学习的课程
+func (r *Run) cancelCourse(task Task) {
+	output(task, fmt.Sprintf("课程[%s][%d]: 运行已取消", task.Course.Name, task.Course.ID))
+	r.setStatus(task, StateFailed, -1)
+	r.done()
+}
 
+// work 学习单个课程, 存在未解锁的节点时返回最早的解锁时间, 否则返回零值
+func (r *Run) work(task Task) time.Time {
 	// 更新任务状态为进行中
-	UserProgressMap.mu.Lock()
-	if _, exists := UserProgressMap.data[userID]; exists {
-		if progress, exists := UserProgressMap.data[userID][courseID]; exists {
-			progress.Status = "in_progress"
-			UserProgressMap.data[userID][courseID] = progress
-		}
-	}
-	UserProgressMap.mu.Unlock()
+	r.setStatus(task, StateInProgress, -1)
 
-	// 检查是否有停止标记
-	if checkStopFlag() {
-		logrus.Info("检测到停止标记，跳过任务")
+	// 检查运行是否已被取消
+	if r.Canceled() {
+		logrus.Info("运行已取消，跳过任务")
 
 		// 更新任务状态为失败
-		UserProgressMap.mu.Lock()
-		if _, exists := UserProgressMap.data[userID]; exists {
-			if progress, exists := UserProgressMap.data[userID][courseID]; exists {
-				progress.Status = "failed"
-				UserProgressMap.data[userID][courseID] = progress
-			}
-		}
-		UserProgressMap.mu.Unlock()
-		return
+		r.setStatus(task, StateFailed, -1)
+		return time.Time{}
 	}
-	instance := yinghua.New(task.User) // 检查是否有停止标记
-	if checkStopFlag() {
-		logrus.Info("检测到停止标记，取消登录")
-		return
+	ctx := r.ctx
+	driver, err := platform.New(task.User)
+	if err != nil {
+		outputWith(task, err.Error(), logrus.Errorf)
+		r.setStatus(task, StateFailed, -1)
+		return time.Time{}
 	}
-	err := instance.Login()
+	err = driver.Login(ctx)
 	if err != nil {
-		logrus.Fatal(err)
+		// 登录失败只影响当前课程, 不中断其他用户的任务
+		if ctx.Err() == nil {
+			outputWith(task, fmt.Sprintf("课程[%s][%d]: 登录失败: %s", task.Course.Name, task.Course.ID, err.Error()), logrus.Errorf)
+		}
+		r.setStatus(task, StateFailed, -1)
+		return time.Time{}
 	}
 
-	instance.Output("登录成功")
+	output(task, "登录成功")
 
-	// 检查是否有停止标记
-	if checkStopFlag() {
-		logrus.Info("检测到停止标记，取消课程处理")
-		return
+	// 检查运行是否已被取消
+	if r.Canceled() {
+		logrus.Info("运行已取消，取消课程处理")
+		r.setStatus(task, StateFailed, -1)
+		return time.Time{}
 	}
 
-	if task.Course.Progress == 1 {
-		instance.Output(fmt.Sprintf("当前课程[%s][%d] 进度: %s, 跳过", task.Course.Name, task.Course.ID, task.Course.Progress1))
+	if task.Course.Progress >= 1 {
+		output(task, fmt.Sprintf("当前课程[%s][%d] 进度: %s, 跳过", task.Course.Name, task.Course.ID, task.Course.ProgressText))
 
 		// 更新任务状态为完成
-		UserProgressMap.mu.Lock()
-		if _, exists := UserProgressMap.data[userID]; exists {
-			if progress, exists := UserProgressMap.data[userID][courseID]; exists {
-				progress.Progress = 100
-				progress.Status = "completed"
-				UserProgressMap.data[userID][courseID] = progress
-			}
-		}
-		UserProgressMap.mu.Unlock()
-
-		return
+		r.setStatus(task, StateCompleted, 100)
+		return time.Time{}
 	}
-	if task.Course.State == 2 {
-		instance.Output(fmt.Sprintf("当前课程[%s][%d] 已结束, 进度设置为100%%", task.Course.Name, task.Course.ID))
+	switch courseWindow(task.Course, time.Now()) {
+	case WindowEnded:
+		output(task, fmt.Sprintf("当前课程[%s][%d] 已结束, 进度设置为100%%", task.Course.Name, task.Course.ID))
 
 		// 更新任务状态为完成
-		UserProgressMap.mu.Lock()
-		// 确保用户进度映射存在
-		if _, exists := UserProgressMap.data[userID]; !exists {
-			UserProgressMap.data[userID] = make(map[int]UserCourseProgress)
-		}
-		// 确保课程进度存在并更新
-		progress := UserProgressMap.data[userID][courseID]
-		progress.Progress = 100
-		progress.Status = "completed"
-		UserProgressMap.data[userID][courseID] = progress
-		UserProgressMap.mu.Unlock()
-
-		return
+		r.setStatus(task, StateCompleted, 100)
+		return time.Time{}
+	case WindowNotStarted:
+		output(task, fmt.Sprintf("当前课程[%s][%d] 尚未开课, 将于 %s 开课, 跳过", task.Course.Name, task.Course.ID, task.Course.StartAt.Format("2006-01-02 15:04")))
+		r.setStatus(task, StateSkipped, -1)
+		return time.Time{}
 	}
-	instance.Output(fmt.Sprintf("当前课程[%s][%d] 进度: %s", task.Course.Name, task.Course.ID, task.Course.Progress1))
-	err = instance.StudyCourse(task.Course)
-	if err != nil {
-		instance.OutputWith(fmt.Sprintf("课程[%s][%d]: %s", task.Course.Name, task.Course.ID, err.Error()), logrus.Errorf)
+	output(task, fmt.Sprintf("当前课程[%s][%d] 进度: %s", task.Course.Name, task.Course.ID, task.Course.ProgressText))
+	wakeAt, err := r.studyCourse(ctx, driver, task)
+	if ctx.Err() != nil {
+		output(task, fmt.Sprintf("课程[%s][%d]: 运行已取消", task.Course.Name, task.Course.ID))
+		r.setStatus(task, StateFailed, -1)
+	} else if err != nil {
+		outputWith(task, fmt.Sprintf("课程[%s][%d]: %s", task.Course.Name, task.Course.ID, err.Error()), logrus.Errorf)
 
 		// 更新任务状态为失败
-		UserProgressMap.mu.Lock()
-		if _, exists := UserProgressMap.data[userID]; exists {
-			if progress, exists := UserProgressMap.data[userID][courseID]; exists {
-				progress.Status = "failed"
-				UserProgressMap.data[userID][courseID] = progress
-			}
-		}
-		UserProgressMap.mu.Unlock()
+		r.setStatus(task, StateFailed, -1)
+	} else if !wakeAt.IsZero() {
+		output(task, fmt.Sprintf("课程[%s][%d]: 还有未解锁的节点, 将于 %s 继续学习", task.Course.Name, task.Course.ID, wakeAt.Format("2006-01-02 15:04:05")))
+		r.setStatus(task, StateWaiting, -1)
+		return wakeAt
 	} else {
 		// 更新任务状态为完成
-		UserProgressMap.mu.Lock()
-		if _, exists := UserProgressMap.data[userID]; exists {
-			if progress, exists := UserProgressMap.data[userID][courseID]; exists {
-				progress.Progress = 100
-				progress.Status = "completed"
-				UserProgressMap.data[userID][courseID] = progress
-			}
-		}
-		UserProgressMap.mu.Unlock()
+		r.setStatus(task, StateCompleted, 100)
 	}
-
+	return time.Time{}
 }
 
-// GetUserCourseProgress 获取所有用户的课程进度数据
-func GetUserCourseProgress() map[string]map[int]UserCourseProgress {
-	UserProgressMap.mu.Lock()
-	defer UserProgressMap.mu.Unlock()
-
-	// 创建一个副本以避免并发问题
-	result := make(map[string]map[int]UserCourseProgress)
-	for userID, courses := range UserProgressMap.data {
-		result[userID] = make(map[int]UserCourseProgress)
-		for courseID, progress := range courses {
-			result[userID][courseID] = progress
+// resumable 恢复运行时仅保留上次未完成的课程
+func (r *Run) resumable(user config.User, tasks []Task) []Task {
+	courses, ok := r.resume[user.Username]
+	if !ok {
+		return tasks
+	}
+	var result []Task
+	for _, task := range tasks {
+		if courses[task.Course.ID] {
+			result = append(result, task)
 		}
 	}
-
+	logrus.Infof("用户 %s 恢复上次运行[%s], 继续 %d 门未完成课程", user.Username, r.ID, len(result))
 	return result
 }
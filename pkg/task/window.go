@@ -0,0 +1,151 @@
+package task
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/platform"
+)
+
+// 课程开放状态
+const (
+	WindowUnknown    = "unknown"     // 没有开课与结课时间
+	WindowNotStarted = "not_started" // 尚未开课
+	WindowOpen       = "open"        // 开放中
+	WindowEnded      = "ended"       // 已结课
+)
+
+// courseWindow 根据开课与结课时间判断课程在 now 时的开放状态
+func courseWindow(course platform.Course, now time.Time) string {
+	switch {
+	case course.Ended || (!course.EndAt.IsZero() && !now.Before(course.EndAt)):
+		return WindowEnded
+	case !course.StartAt.IsZero() && now.Before(course.StartAt):
+		return WindowNotStarted
+	case course.StartAt.IsZero() && course.EndAt.IsZero():
+		return WindowUnknown
+	}
+	return WindowOpen
+}
+
+// atRisk 按实时学习剩余 remaining 秒视频, 课程是否会在学完之前结课
+func atRisk(endAt time.Time, remaining int, now time.Time) bool {
+	if endAt.IsZero() || remaining <= 0 {
+		return false
+	}
+	return now.Add(time.Duration(remaining) * time.Second).After(endAt)
+}
+
+// deadlineWarning 课程可能无法按时学完时的提示, 否则返回空字符串
+func deadlineWarning(endAt time.Time, remaining int, now time.Time) string {
+	if !atRisk(endAt, remaining, now) {
+		return ""
+	}
+	return fmt.Sprintf("课程将于 %s 结课, 剩余视频约 %s, 可能无法按时学完", endAt.Format("2006-01-02 15:04"), formatSeconds(remaining))
+}
+
+// sortByDeadline 按结课时间排序, 结课越早越优先, 没有结课时间的课程排在最后并保持原顺序
+func sortByDeadline(tasks []Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return endsBefore(tasks[i].Course, tasks[j].Course)
+	})
+}
+
+// endsBefore 课程 a 是否早于 b 结课, 没有结课时间的视为最晚
+func endsBefore(a, b platform.Course) bool {
+	if a.EndAt.IsZero() || b.EndAt.IsZero() {
+		return !a.EndAt.IsZero() && b.EndAt.IsZero()
+	}
+	return a.EndAt.Before(b.EndAt)
+}
+
+// CalendarEntry 课程日历中的一门课程
+type CalendarEntry struct {
+	CourseID   int        `json:"course_id"`
+	CourseName string     `json:"course_name"`
+	StartAt    *time.Time `json:"start_at,omitempty"`
+	EndAt      *time.Time `json:"end_at,omitempty"`
+	// Window 开放状态, 见 Window* 常量
+	Window string `json:"window"`
+	// DaysLeft 距离结课的天数, 没有结课时间或已结课时为空
+	DaysLeft *int `json:"days_left,omitempty"`
+	// Progress 平台统计的课程进度 0-100
+	Progress float64 `json:"progress"`
+	// Remaining 剩余视频时长, 单位秒, 仅在运行中获取过章节的课程有值
+	Remaining *int `json:"remaining,omitempty"`
+	// AtRisk 按剩余视频时长可能无法在结课前学完
+	AtRisk bool `json:"at_risk"`
+}
+
+// Calendar 按结课时间生成用户的课程日历, remaining 为已知的课程剩余视频时长
+func Calendar(courses []platform.Course, remaining map[int]int, now time.Time) []CalendarEntry {
+	tasks := make([]Task, 0, len(courses))
+	for _, course := range courses {
+		tasks = append(tasks, Task{Course: course})
+	}
+	sortByDeadline(tasks)
+
+	entries := make([]CalendarEntry, 0, len(tasks))
+	for _, task := range tasks {
+		course := task.Course
+		entry := CalendarEntry{
+			CourseID:   course.ID,
+			CourseName: course.Name,
+			Window:     courseWindow(course, now),
+			Progress:   course.Progress * 100,
+		}
+		if !course.StartAt.IsZero() {
+			start := course.StartAt
+			entry.StartAt = &start
+		}
+		if !course.EndAt.IsZero() {
+			end := course.EndAt
+			entry.EndAt = &end
+			if entry.Window != WindowEnded {
+				days := int(end.Sub(now).Hours() / 24)
+				entry.DaysLeft = &days
+			}
+		}
+		if seconds, ok := remaining[course.ID]; ok {
+			entry.Remaining = &seconds
+			entry.AtRisk = entry.Window != WindowEnded && atRisk(course.EndAt, seconds, now)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Remaining 获取运行中用户各课程的剩余视频时长, 单位秒
+func (r *Run) Remaining(user string) map[int]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make(map[int]int)
+	for id, course := range r.courses[user] {
+		if len(course.Chapters) > 0 {
+			result[id] = course.Remaining
+		}
+	}
+	return result
+}
+
+// formatSeconds 将秒数格式化为 "1小时2分" 的形式
+func formatSeconds(seconds int) string {
+	d := time.Duration(seconds) * time.Second
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	if hours > 0 {
+		return fmt.Sprintf("%d小时%d分", hours, minutes)
+	}
+	return fmt.Sprintf("%d分", minutes)
+}
+
+// warning 获取课程当前的结课提示
+func (r *Run) warning(task Task) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cp, ok := r.courses[task.User.Username][task.Course.ID]; ok {
+		return cp.Warning
+	}
+	return ""
+}
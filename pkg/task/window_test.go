@@ -0,0 +1,55 @@
+package task_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/task"
+)
+
+func TestCalendar(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	courses := []platform.Course{
+		{ID: 1, Name: "没有时间"},
+		{ID: 2, Name: "下学期", StartAt: now.AddDate(0, 1, 0), EndAt: now.AddDate(0, 4, 0)},
+		{ID: 3, Name: "即将结课", StartAt: now.AddDate(0, -3, 0), EndAt: now.Add(time.Hour), Progress: 0.5},
+		{ID: 4, Name: "已结课", EndAt: now.AddDate(0, 0, -1), Ended: true},
+		{ID: 5, Name: "进行中", EndAt: now.AddDate(0, 0, 10)},
+	}
+	remaining := map[int]int{3: 2 * 3600, 5: 600}
+
+	entries := task.Calendar(courses, remaining, now)
+
+	var order []int
+	for _, entry := range entries {
+		order = append(order, entry.CourseID)
+	}
+	if want := []int{4, 3, 5, 2, 1}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("课程顺序 = %v, 期望 %v", order, want)
+	}
+
+	windows := map[int]string{1: task.WindowUnknown, 2: task.WindowNotStarted, 3: task.WindowOpen, 4: task.WindowEnded, 5: task.WindowOpen}
+	for _, entry := range entries {
+		if entry.Window != windows[entry.CourseID] {
+			t.Errorf("课程 %d 状态 = %s, 期望 %s", entry.CourseID, entry.Window, windows[entry.CourseID])
+		}
+		if atRisk := entry.CourseID == 3; entry.AtRisk != atRisk {
+			t.Errorf("课程 %d AtRisk = %v, 期望 %v", entry.CourseID, entry.AtRisk, atRisk)
+		}
+	}
+
+	if entry := entries[1]; entry.Progress != 50 || entry.Remaining == nil || *entry.Remaining != 2*3600 {
+		t.Errorf("课程 3 = %+v, 期望进度 50 且剩余 7200 秒", entry)
+	}
+	if entry := entries[2]; entry.DaysLeft == nil || *entry.DaysLeft != 10 {
+		t.Errorf("课程 5 剩余天数 = %v, 期望 10", entry.DaysLeft)
+	}
+	if entry := entries[0]; entry.DaysLeft != nil {
+		t.Errorf("已结课的课程不应返回剩余天数")
+	}
+	if entry := entries[4]; entry.Remaining != nil || entry.EndAt != nil {
+		t.Errorf("没有时间的课程 = %+v, 期望不返回结课时间与剩余时长", entry)
+	}
+}
@@ -0,0 +1,18 @@
+package util
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep 可被上下文中断的等待, 上下文取消时立即返回其错误
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -1,14 +1,12 @@
 package util
 
 import (
-	"bufio"
 	"bytes"
 	"github.com/aoaostar/mooc/pkg/config"
 	"github.com/sirupsen/logrus"
 	"os"
 	"runtime"
 	"strconv"
-	"strings"
 )
 
 func SaveJson(filename, data string) {
@@ -30,45 +28,9 @@ func GetGid() (gid uint64) {
 	return n
 }
 
-func ReadText(filename string, line int, limit int) ([]string, error) {
-	var data []string
-	file, err := os.Open(filename)
-	if err != nil {
-		return []string{}, err
-	}
-
-	var count = 0
-	s := bufio.NewScanner(file)
-	for s.Scan() {
-		count++
-	}
-	//超出行数
-	if line > count {
-		return []string{}, nil
-	}
-	_, err = file.Seek(0, 0)
-	if err != nil {
-		return nil, err
-	}
-	r := bufio.NewScanner(file)
-	if line == 0 {
-		if limit == 0 {
-			line = count
-		} else {
-			line = limit
-		}
-	}
-	index := 0
-	for r.Scan() {
-		if limit != 0 && len(data) >= limit {
-			break
-		}
-		if index >= count-line {
-			data = append(data, strings.TrimSpace(r.Text()))
-		}
-		index++
-	}
-	return data, nil
+// Output 输出带协程ID与用户名前缀的日志, 日志格式化器据此为用户名着色
+func Output(username string, message string, writer func(format string, args ...interface{})) {
+	writer("[协程ID=%d][%s] %s", GetGid(), username, message)
 }
 
 func Copyright() {
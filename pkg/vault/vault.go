@@ -0,0 +1,175 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Prefix 加密值的前缀, 格式为 enc:v1:base64(salt|nonce|ciphertext)
+const Prefix = "enc:v1:"
+
+// PassphraseEnv 主密码环境变量, 设置后优先于本地密钥文件
+const PassphraseEnv = "MOOC_MASTER_PASSWORD"
+
+// DefaultKeyFile 默认本地密钥文件
+const DefaultKeyFile = "./data/vault.key"
+
+const (
+	saltSize   = 16
+	keySize    = 32
+	iterations = 100000
+)
+
+var ErrDecrypt = errors.New("密码解密失败, 请检查主密码或密钥文件")
+
+// Vault 使用主密码或本地密钥文件派生的密钥加解密凭据
+type Vault struct {
+	secret []byte
+
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+// Open 打开凭据库: 优先使用环境变量中的主密码, 否则读取本地密钥文件
+// create 为 true 且密钥文件不存在时生成新的随机密钥
+func Open(keyFile string, create bool) (*Vault, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return newVault([]byte(passphrase)), nil
+	}
+
+	secret, err := os.ReadFile(keyFile)
+	if err == nil {
+		return newVault(secret), nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, errors.New("读取密钥文件失败: " + err.Error())
+	}
+
+	secret = make([]byte, keySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyFile, secret, 0600); err != nil {
+		return nil, errors.New("写入密钥文件失败: " + err.Error())
+	}
+	return newVault(secret), nil
+}
+
+func newVault(secret []byte) *Vault {
+	return &Vault{secret: secret, keys: make(map[string][]byte)}
+}
+
+// IsEncrypted 值是否为加密后的格式
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt 加密明文, 已加密的值原样返回
+func (v *Vault) Encrypt(plain string) (string, error) {
+	if IsEncrypted(plain) {
+		return plain, nil
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	gcm, err := v.cipher(salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	data := append(salt, nonce...)
+	data = gcm.Seal(data, nonce, []byte(plain), nil)
+	return Prefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt 解密, 未加密的值原样返回
+func (v *Vault) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil || len(data) < saltSize {
+		return "", ErrDecrypt
+	}
+	gcm, err := v.cipher(data[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return "", ErrDecrypt
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plain), nil
+}
+
+// cipher 根据盐派生 AES-256-GCM, 派生结果按盐缓存
+func (v *Vault) cipher(salt []byte) (cipher.AEAD, error) {
+	v.mu.Lock()
+	key, ok := v.keys[string(salt)]
+	if !ok {
+		key = pbkdf2(sha256.New, v.secret, salt, iterations, keySize)
+		v.keys[string(salt)] = key
+	}
+	v.mu.Unlock()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 PBKDF2 密钥派生 (RFC 8018), 伪随机函数为 HMAC-h, 凭据库固定使用 SHA-256
+func pbkdf2(h func() hash.Hash, password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	key := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		key = prf.Sum(key)
+		t := key[len(key)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	cases := []struct {
+		name     string
+		hash     func() hash.Hash
+		password string
+		salt     string
+		iter     int
+		keyLen   int
+		want     string
+	}{
+		// RFC 6070 第 2 节, PBKDF2-HMAC-SHA1, 省略 16777216 次迭代的用例
+		{"sha1-1", sha1.New, "password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"sha1-2", sha1.New, "password", "salt", 2, 20, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"sha1-4096", sha1.New, "password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+		{"sha1-long", sha1.New, "passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{"sha1-nul", sha1.New, "pass\x00word", "sa\x00lt", 4096, 16, "56fa6aa75548099dcc37d7f03425e0c3"},
+		// RFC 7914 第 11 节, PBKDF2-HMAC-SHA256, 即凭据库实际使用的算法
+		{"sha256-1", sha256.New, "passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"sha256-80000", sha256.New, "Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := hex.EncodeToString(pbkdf2(c.hash, []byte(c.password), []byte(c.salt), c.iter, c.keyLen))
+			if got != c.want {
+				t.Errorf("pbkdf2 = %s, 期望 %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	v := newVault([]byte("master"))
+	for _, plain := range []string{"secret", "", "中文密码"} {
+		encrypted, err := v.Encrypt(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(encrypted) {
+			t.Fatalf("加密结果 = %q", encrypted)
+		}
+		if again, _ := v.Encrypt(encrypted); again != encrypted {
+			t.Errorf("已加密的值应原样返回")
+		}
+		decrypted, err := v.Decrypt(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != plain {
+			t.Errorf("解密结果 = %q, 期望 %q", decrypted, plain)
+		}
+	}
+	if plain, err := v.Decrypt("plain"); err != nil || plain != "plain" {
+		t.Errorf("未加密的值 = %q, %v, 期望原样返回", plain, err)
+	}
+}
+
+func TestDecryptRejectsWrongKey(t *testing.T) {
+	encrypted, err := newVault([]byte("master")).Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newVault([]byte("other")).Decrypt(encrypted); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("错误 = %v, 期望 ErrDecrypt", err)
+	}
+}
+
+func TestDecryptRejectsTamperedValue(t *testing.T) {
+	v := newVault([]byte("master"))
+	encrypted, err := v.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, Prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+
+	for name, value := range map[string]string{
+		"密文被修改":    Prefix + base64.StdEncoding.EncodeToString(data),
+		"密文被截断":    Prefix + base64.StdEncoding.EncodeToString(data[:saltSize+4]),
+		"不是base64": Prefix + "!!!",
+	} {
+		if _, err := v.Decrypt(value); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: 错误 = %v, 期望 ErrDecrypt", name, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package yinghua
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/go-resty/resty/v2"
+)
+
+// 接口的错误码没有公开文档, 按消息关键字归类
+var (
+	credentialWords   = []string{"密码", "账号", "用户名", "用户不存在"}
+	tokenExpiredWords = []string{"登录", "token"}
+	nodeLockedWords   = []string{"解锁", "锁定", "未开放", "未开始"}
+	rateLimitedWords  = []string{"频繁", "稍后"}
+)
+
+// classify 将接口返回的非0错误码归类为平台错误
+// login 为登录接口, 仅用户名或密码错误视为 ErrAuth, 其他失败按服务端错误重试
+func classify(code int, msg string, needCode bool, login bool) error {
+	kind := platform.ErrServer
+	switch {
+	case containsAny(msg, rateLimitedWords):
+		kind = platform.ErrRateLimited
+	case login && containsAny(msg, credentialWords):
+		kind = platform.ErrAuth
+	case needCode:
+		kind = platform.ErrCaptchaRequired
+	case login:
+		// 登录接口的其他失败与令牌和节点无关
+		kind = platform.ErrServer
+	case containsAny(msg, tokenExpiredWords):
+		kind = platform.ErrTokenExpired
+	case containsAny(msg, nodeLockedWords):
+		kind = platform.ErrNodeLocked
+	}
+	return platform.NewError(kind, code, msg)
+}
+
+// checkStatus 检查 HTTP 状态码, 非 2xx 响应不会解析响应体, 需单独归类
+func checkStatus(resp *resty.Response) error {
+	if !resp.IsError() {
+		return nil
+	}
+	kind := platform.ErrServer
+	switch resp.StatusCode() {
+	case http.StatusTooManyRequests:
+		kind = platform.ErrRateLimited
+	case http.StatusUnauthorized, http.StatusForbidden:
+		kind = platform.ErrTokenExpired
+	}
+	return &platform.Error{Kind: kind, Status: resp.StatusCode(), Msg: resp.Status()}
+}
+
+func containsAny(s string, words []string) bool {
+	s = strings.ToLower(s)
+	for _, word := range words {
+		if strings.Contains(s, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package yinghua_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/yinghua"
+	"github.com/aoaostar/mooc/pkg/yinghua/yinghuatest"
+)
+
+func TestErrorClassification(t *testing.T) {
+	srv := yinghuatest.NewServer()
+	defer srv.Close()
+	srv.AddUser("alice", "secret")
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"))
+
+	ctx := context.Background()
+	driver := yinghua.New(config.User{BaseURL: srv.URL, Username: "alice", Password: "wrong"})
+	err := driver.Login(ctx)
+	if !errors.Is(err, platform.ErrAuth) {
+		t.Fatalf("密码错误 = %v, 期望 ErrAuth", err)
+	}
+	var apiErr *platform.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 1 || apiErr.Msg != "用户名或密码错误" {
+		t.Fatalf("错误详情 = %+v", apiErr)
+	}
+
+	// 登录接口的服务端错误不是密码错误
+	srv.Fail("/api/login.json", yinghuatest.Failure{Code: 500, Msg: "系统繁忙"})
+	if err := driver.Login(ctx); !errors.Is(err, platform.ErrServer) || errors.Is(err, platform.ErrAuth) {
+		t.Fatalf("登录服务端错误 = %v, 期望 ErrServer", err)
+	}
+
+	driver = yinghua.New(config.User{BaseURL: srv.URL, Username: "alice", Password: "secret"})
+	// 不自动重新登录, 直接返回原始错误
+	driver.MaxRelogin = 0
+	if err := driver.Login(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		failure yinghuatest.Failure
+		kind    error
+	}{
+		{"令牌失效", yinghuatest.Failure{Code: 1, Msg: "请先登录"}, platform.ErrTokenExpired},
+		{"节点锁定", yinghuatest.Failure{Code: 1, Msg: "该节点尚未解锁"}, platform.ErrNodeLocked},
+		{"请求频繁", yinghuatest.Failure{Code: 1, Msg: "操作过于频繁"}, platform.ErrRateLimited},
+		{"其他错误", yinghuatest.Failure{Code: 500, Msg: "系统错误"}, platform.ErrServer},
+		{"HTTP 429", yinghuatest.Failure{Status: http.StatusTooManyRequests}, platform.ErrRateLimited},
+		{"HTTP 502", yinghuatest.Failure{Status: http.StatusBadGateway}, platform.ErrServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.Fail("/api/course.json", tt.failure)
+			_, err := driver.ListCourses(ctx)
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("错误 = %v, 期望 %v", err, tt.kind)
+			}
+		})
+	}
+
+	srv.ExpireTokens()
+	if _, err := driver.ListCourses(ctx); !errors.Is(err, platform.ErrTokenExpired) {
+		t.Fatalf("令牌过期 = %v, 期望 ErrTokenExpired", err)
+	}
+}
@@ -0,0 +1,116 @@
+package yinghua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/util"
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMaxRelogin 登录失效后最多尝试重新登录的次数
+	DefaultMaxRelogin = 3
+	// DefaultReloginBackoff 重新登录失败后的首次等待时间, 之后每次翻倍
+	DefaultReloginBackoff = 5 * time.Second
+)
+
+// response 接口响应, 由 types 中的各响应类型实现
+type response interface {
+	Outcome() (code int, msg string, needCode bool)
+}
+
+// post 发送接口请求并检查响应, 登录失效时自动重新登录并重试原请求
+func (i *YingHua) post(ctx context.Context, path string, form map[string]string, result response) error {
+	for attempt := 0; ; attempt++ {
+		token := i.token()
+		err := i.request(ctx, path, form, result)
+		if !errors.Is(err, platform.ErrTokenExpired) || attempt >= i.MaxRelogin {
+			return err
+		}
+		i.OutputWith(fmt.Sprintf("%s, 正在重新登录", err.Error()), logrus.Warnf)
+		if err := i.relogin(ctx, token); err != nil {
+			return err
+		}
+	}
+}
+
+// request 发送一次接口请求, 将 HTTP 状态码与接口错误码转换为平台错误
+func (i *YingHua) request(ctx context.Context, path string, form map[string]string, result response) error {
+	// 重试时清空上次的响应, 避免残留的错误码
+	value := reflect.ValueOf(result).Elem()
+	value.Set(reflect.Zero(value.Type()))
+
+	req := i.client.R().SetContext(ctx).SetResult(result)
+	if form != nil {
+		req.SetFormData(form)
+	}
+	resp, err := req.Post(path)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if code, msg, needCode := result.Outcome(); code != 0 {
+		return classify(code, msg, needCode, false)
+	}
+	return nil
+}
+
+// relogin 重新登录, stale 为失效的令牌, 其他请求已经完成重新登录时直接返回
+// 网络错误、平台内部错误与请求频繁按退避间隔重试 MaxRelogin 次, 用户名或密码错误等其他错误立即放弃
+func (i *YingHua) relogin(ctx context.Context, stale string) error {
+	i.loginMu.Lock()
+	defer i.loginMu.Unlock()
+	if i.token() != stale {
+		return nil
+	}
+
+	backoff := i.ReloginBackoff
+	var err error
+	for attempt := 1; attempt <= i.MaxRelogin; attempt++ {
+		if err = i.login(ctx); err == nil {
+			i.Output("重新登录成功")
+			return nil
+		}
+		if ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		i.OutputWith(fmt.Sprintf("第 %d 次重新登录失败: %s", attempt, err.Error()), logrus.Warnf)
+		if attempt < i.MaxRelogin {
+			if err := util.Sleep(ctx, backoff); err != nil {
+				return err
+			}
+			backoff *= 2
+		}
+	}
+	// 多次失败后按登录失效处理, 由调用方结束当前课程
+	return platform.NewError(platform.ErrTokenExpired, 0, "重新登录失败: "+err.Error())
+}
+
+// token 当前登录令牌, 未登录时为空
+func (i *YingHua) token() string {
+	i.tokenMu.RLock()
+	defer i.tokenMu.RUnlock()
+	return i.session
+}
+
+func (i *YingHua) setToken(token string) {
+	i.tokenMu.Lock()
+	defer i.tokenMu.Unlock()
+	i.session = token
+}
+
+// injectToken 在每个请求中附带当前的登录令牌
+func (i *YingHua) injectToken(_ *resty.Client, req *resty.Request) error {
+	if token := i.token(); token != "" {
+		req.FormData.Set("token", token)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package yinghua_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/yinghua"
+	"github.com/aoaostar/mooc/pkg/yinghua/yinghuatest"
+	"github.com/sirupsen/logrus"
+)
+
+const loginPath = "/api/login.json"
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newSession 启动模拟服务并返回已登录的驱动
+func newSession(t *testing.T) (*yinghuatest.Server, *yinghua.YingHua) {
+	t.Helper()
+	srv := yinghuatest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddUser("alice", "secret")
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"))
+
+	driver := yinghua.New(config.User{BaseURL: srv.URL, Username: "alice", Password: "secret"})
+	driver.ReloginBackoff = time.Millisecond
+	if err := driver.Login(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return srv, driver
+}
+
+func TestReloginWhenTokenExpires(t *testing.T) {
+	srv, driver := newSession(t)
+	srv.ExpireTokens()
+
+	courses, err := driver.ListCourses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(courses) != 1 {
+		t.Fatalf("课程数 = %d, 期望 1", len(courses))
+	}
+	if n := srv.Requests(loginPath); n != 2 {
+		t.Errorf("登录 %d 次, 期望 2", n)
+	}
+}
+
+func TestReloginRetriesWithBackoff(t *testing.T) {
+	srv, driver := newSession(t)
+	srv.ExpireTokens()
+	srv.Fail(loginPath, yinghuatest.Failure{Status: http.StatusBadGateway}, yinghuatest.Failure{Code: 1, Msg: "请求过于频繁"})
+
+	if _, err := driver.ListCourses(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests(loginPath); n != 4 {
+		t.Errorf("登录 %d 次, 期望 4", n)
+	}
+}
+
+func TestReloginGivesUp(t *testing.T) {
+	srv, driver := newSession(t)
+	srv.ExpireTokens()
+	for i := 0; i < yinghua.DefaultMaxRelogin; i++ {
+		srv.Fail(loginPath, yinghuatest.Failure{Status: http.StatusBadGateway})
+	}
+
+	_, err := driver.ListCourses(context.Background())
+	if !errors.Is(err, platform.ErrTokenExpired) {
+		t.Fatalf("错误 = %v, 期望 ErrTokenExpired", err)
+	}
+	if n := srv.Requests(loginPath); n != 1+yinghua.DefaultMaxRelogin {
+		t.Errorf("登录 %d 次, 期望 %d", n, 1+yinghua.DefaultMaxRelogin)
+	}
+}
+
+func TestReloginStopsOnWrongPassword(t *testing.T) {
+	srv, driver := newSession(t)
+	srv.ExpireTokens()
+	srv.AddUser("alice", "changed")
+
+	_, err := driver.ListCourses(context.Background())
+	if !errors.Is(err, platform.ErrAuth) {
+		t.Fatalf("错误 = %v, 期望 ErrAuth", err)
+	}
+	if n := srv.Requests(loginPath); n != 2 {
+		t.Errorf("登录 %d 次, 期望 2", n)
+	}
+}
+
+func TestReloginRetriesServerError(t *testing.T) {
+	srv, driver := newSession(t)
+	srv.ExpireTokens()
+	srv.Fail(loginPath, yinghuatest.Failure{Code: 500, Msg: "系统繁忙"})
+
+	if _, err := driver.ListCourses(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests(loginPath); n != 3 {
+		t.Errorf("登录 %d 次, 期望 3", n)
+	}
+}
@@ -0,0 +1,220 @@
+package yinghua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/util"
+	"github.com/aoaostar/mooc/pkg/yinghua/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMaxRetries 学习节点时网络或平台错误连续重试的次数
+	DefaultMaxRetries = 3
+	// DefaultMaxCaptcha 学习单个节点时最多识别验证码的次数
+	DefaultMaxCaptcha = 5
+	// DefaultNodeTimeout 视频时长未知时单个节点的最长学习时间
+	DefaultNodeTimeout = 2 * time.Hour
+)
+
+// studyState 节点学习状态
+type studyState int
+
+const (
+	stateStarting    studyState = iota // 开始学习, 恢复断点
+	stateStudying                      // 上报学习时长
+	statePolling                       // 查询节点进度
+	stateCaptchaWait                   // 等待识别验证码
+	stateDone                          // 学习完成
+	stateFailed                        // 学习失败
+)
+
+var stateNames = [...]string{"starting", "studying", "polling", "captcha-wait", "done", "failed"}
+
+func (s studyState) String() string {
+	return stateNames[s]
+}
+
+// nodeStudy 单个节点的学习过程, 所有状态只在调用 StudyNode 的协程中读写
+type nodeStudy struct {
+	*YingHua
+	study platform.Study
+	state studyState
+	err   error
+
+	studyID   int
+	studyTime int
+	// code 已识别待提交的验证码
+	code     string
+	progress platform.NodeProgress
+	retries  int
+	captchas int
+}
+
+// StudyNode 学习单个视频节点直到完成, 上下文取消或超过 NodeTimeout 时返回
+// 每个间隔依次上报学习时长并查询进度, 需要验证码时识别后重新上报
+func (i *YingHua) StudyNode(ctx context.Context, study platform.Study) error {
+	timeout := i.nodeTimeout(study.Node)
+	nodeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	s := &nodeStudy{YingHua: i, study: study, state: stateStarting}
+	for {
+		logrus.Debugf("[nodeId=%d] 学习状态: %s", study.Node.ID, s.state)
+		switch s.state {
+		case stateStarting:
+			s.start()
+		case stateStudying:
+			s.report(nodeCtx)
+		case statePolling:
+			s.poll(nodeCtx)
+		case stateCaptchaWait:
+			s.solve(nodeCtx)
+		case stateDone:
+			return nil
+		case stateFailed:
+			if ctx.Err() == nil && errors.Is(s.err, context.DeadlineExceeded) {
+				return fmt.Errorf("节点学习超时(%s)", timeout)
+			}
+			return s.err
+		}
+	}
+}
+
+// nodeTimeout 单个节点的最长学习时间, 每个间隔上报10秒学习时长, 预留一倍时间及重试的余量
+func (i *YingHua) nodeTimeout(node platform.Node) time.Duration {
+	if i.NodeTimeout > 0 {
+		return i.NodeTimeout
+	}
+	if node.Duration <= 0 {
+		return DefaultNodeTimeout
+	}
+	reports := node.Duration/10 + 1
+	return time.Duration(reports*2+30) * i.Interval
+}
+
+func (s *nodeStudy) start() {
+	node := s.study.Node
+	s.Output(fmt.Sprintf("课程: [%s] 章节: [%s] 当前第 %d 课, [%s][nodeId=%d]", s.study.Course.Name, s.study.Chapter.Name, node.Index, node.Name, node.ID))
+	s.studyTime = 1
+	if checkpoint := s.study.Checkpoint; checkpoint.StudyTime >= 1 {
+		// 从上次中断的位置继续
+		s.studyTime = checkpoint.StudyTime
+		s.studyID = checkpoint.StudyID
+		s.Output(fmt.Sprintf("%s 从断点继续[studyId=%d][studyTime=%d]", s.prefix(), s.studyID, s.studyTime))
+	}
+	s.state = statePolling
+}
+
+// report 上报学习时长
+func (s *nodeStudy) report(ctx context.Context) {
+	form := map[string]string{
+		"nodeId":    strconv.Itoa(s.study.Node.ID),
+		"studyTime": strconv.Itoa(s.studyTime),
+		"studyId":   strconv.Itoa(s.studyID),
+	}
+	if s.code != "" {
+		form["code"] = s.code + "_"
+	}
+	resp := new(types.StudyNodeResponse)
+	err := s.post(ctx, "/api/node/study.json", form, resp)
+	if errors.Is(err, platform.ErrCaptchaRequired) {
+		s.OutputWith(fmt.Sprintf("%s, %s[studyId=%d][studyTime=%d]", s.prefix(), resp.Msg, s.studyID, s.studyTime), logrus.Errorf)
+		s.state = stateCaptchaWait
+		return
+	}
+	if err != nil {
+		s.retry(ctx, err)
+		return
+	}
+
+	s.retries, s.code = 0, ""
+	s.studyID = resp.Result.Data.StudyID
+	s.Output(fmt.Sprintf("%s, %s[studyId=%d], 当前进度: %.f%%", s.prefix(), resp.Msg, s.studyID, s.progress.Percent))
+	s.studyTime += 10
+	s.study.Progress(s.progress, platform.Checkpoint{StudyID: s.studyID, StudyTime: s.studyTime})
+	if s.sleep(ctx) {
+		s.state = statePolling
+	}
+}
+
+// poll 查询节点进度, 平台记录完成后结束学习
+func (s *nodeStudy) poll(ctx context.Context) {
+	progress, err := s.NodeProgress(ctx, s.study.Node)
+	if err != nil {
+		s.retry(ctx, err)
+		return
+	}
+	s.retries = 0
+	s.progress = progress
+	if progress.Done {
+		s.state = stateDone
+		return
+	}
+	s.state = stateStudying
+}
+
+// solve 识别验证码, 超过 MaxCaptcha 次后放弃当前节点
+func (s *nodeStudy) solve(ctx context.Context) {
+	s.captchas++
+	if s.captchas > s.MaxCaptcha {
+		s.fail(platform.NewError(platform.ErrCaptchaRequired, 0, fmt.Sprintf("验证码 %d 次未通过", s.MaxCaptcha)))
+		return
+	}
+	code := s.FuckCaptcha(ctx)
+	if code == "" {
+		// 识别失败, 等待后重新获取验证码
+		s.sleep(ctx)
+		return
+	}
+	s.code = code
+	s.state = stateStudying
+}
+
+// retry 可重试的错误等待后重试当前状态, 超过 MaxRetries 次或不可重试时学习失败
+func (s *nodeStudy) retry(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		s.fail(ctx.Err())
+		return
+	}
+	if !retryable(err) || s.retries >= s.MaxRetries {
+		s.fail(err)
+		return
+	}
+	s.retries++
+	s.OutputWith(fmt.Sprintf("%s, %s, 第 %d 次重试", s.prefix(), err.Error(), s.retries), logrus.Warnf)
+	s.sleep(ctx)
+}
+
+// sleep 等待一个间隔, 上下文取消时学习失败并返回 false
+func (s *nodeStudy) sleep(ctx context.Context) bool {
+	if err := util.Sleep(ctx, s.Interval); err != nil {
+		s.fail(err)
+		return false
+	}
+	return true
+}
+
+func (s *nodeStudy) fail(err error) {
+	s.err = err
+	s.state = stateFailed
+}
+
+func (s *nodeStudy) prefix() string {
+	node := s.study.Node
+	return fmt.Sprintf("课程: [%s] 章节: [%s] %s[nodeId=%d]", s.study.Course.Name, s.study.Chapter.Name, node.Name, node.ID)
+}
+
+// retryable 网络错误、平台内部错误与请求频繁可以重试, 其他平台错误重试无意义
+func retryable(err error) bool {
+	var apiErr *platform.Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return errors.Is(err, platform.ErrServer) || errors.Is(err, platform.ErrRateLimited)
+}
@@ -0,0 +1,182 @@
+package yinghua_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
+	"github.com/aoaostar/mooc/pkg/yinghua"
+	"github.com/aoaostar/mooc/pkg/yinghua/yinghuatest"
+)
+
+const studyPath = "/api/node/study.json"
+
+// newStudy 启动包含单个视频节点的模拟服务, 返回已登录的驱动与节点
+func newStudy(t *testing.T, duration int) (*yinghuatest.Server, *yinghua.YingHua, platform.Study) {
+	t.Helper()
+	srv := yinghuatest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddUser("alice", "secret")
+	srv.AddCourse(yinghuatest.Course(1, "高等数学"), yinghuatest.Chapter(10, "第一章", yinghuatest.VideoNode(100, "导论", duration)))
+
+	driver := yinghua.New(config.User{BaseURL: srv.URL, Username: "alice", Password: "secret"})
+	driver.Interval = time.Millisecond
+	driver.ReloginBackoff = time.Millisecond
+	driver.Solver = func(ctx context.Context, image []byte) (string, error) {
+		return "abcd", nil
+	}
+	if err := driver.Login(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	study := platform.Study{
+		Course:  platform.Course{ID: 1, Name: "高等数学"},
+		Chapter: platform.Chapter{ID: 10, Name: "第一章"},
+		Node:    platform.Node{ID: 100, Name: "导论", Video: true, Duration: duration},
+	}
+	return srv, driver, study
+}
+
+func TestStudyNodeCompletes(t *testing.T) {
+	srv, driver, study := newStudy(t, 30)
+	var checkpoints []platform.Checkpoint
+	study.OnProgress = func(_ platform.NodeProgress, checkpoint platform.Checkpoint) {
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	if err := driver.StudyNode(context.Background(), study); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Progress(100) < 1 {
+		t.Fatalf("节点进度 = %.2f, 期望完成", srv.Progress(100))
+	}
+	// 学习时长 1, 11, 21, 31
+	if len(checkpoints) != 4 {
+		t.Fatalf("上报 %d 次, 期望 4", len(checkpoints))
+	}
+	if last := checkpoints[len(checkpoints)-1]; last.StudyID == 0 || last.StudyTime != 41 {
+		t.Errorf("断点 = %+v", last)
+	}
+}
+
+func TestStudyNodeResumesFromCheckpoint(t *testing.T) {
+	srv, driver, study := newStudy(t, 30)
+	study.Checkpoint = platform.Checkpoint{StudyID: 7, StudyTime: 21}
+
+	if err := driver.StudyNode(context.Background(), study); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests(studyPath); n != 2 {
+		t.Errorf("上报 %d 次, 期望 2", n)
+	}
+}
+
+func TestStudyNodeSkipsFinishedNode(t *testing.T) {
+	srv, driver, study := newStudy(t, 0)
+
+	if err := driver.StudyNode(context.Background(), study); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests(studyPath); n != 0 {
+		t.Errorf("已完成的节点上报 %d 次, 期望 0", n)
+	}
+}
+
+func TestStudyNodeRetriesTransientErrors(t *testing.T) {
+	srv, driver, study := newStudy(t, 20)
+	srv.Fail(studyPath,
+		yinghuatest.Failure{Status: http.StatusBadGateway},
+		yinghuatest.Failure{Code: 1, Msg: "操作过于频繁"},
+	)
+	srv.Fail("/api/node/video.json", yinghuatest.Failure{Code: 500, Msg: "系统繁忙"})
+
+	if err := driver.StudyNode(context.Background(), study); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Progress(100) < 1 {
+		t.Errorf("重试后节点未完成")
+	}
+}
+
+func TestStudyNodeGivesUpAfterMaxRetries(t *testing.T) {
+	srv, driver, study := newStudy(t, 20)
+	for i := 0; i <= yinghua.DefaultMaxRetries; i++ {
+		srv.Fail(studyPath, yinghuatest.Failure{Code: 500, Msg: "系统错误"})
+	}
+
+	err := driver.StudyNode(context.Background(), study)
+	if !errors.Is(err, platform.ErrServer) {
+		t.Fatalf("错误 = %v, 期望 ErrServer", err)
+	}
+	if n := srv.Requests(studyPath); n != 1+yinghua.DefaultMaxRetries {
+		t.Errorf("上报 %d 次, 期望 %d", n, 1+yinghua.DefaultMaxRetries)
+	}
+}
+
+func TestStudyNodeFailsOnLockedNode(t *testing.T) {
+	srv, driver, study := newStudy(t, 20)
+	srv.Fail(studyPath, yinghuatest.Failure{Code: 1, Msg: "节点尚未解锁"})
+
+	err := driver.StudyNode(context.Background(), study)
+	if !errors.Is(err, platform.ErrNodeLocked) {
+		t.Fatalf("错误 = %v, 期望 ErrNodeLocked", err)
+	}
+	if n := srv.Requests(studyPath); n != 1 {
+		t.Errorf("上报 %d 次, 期望 1", n)
+	}
+}
+
+func TestStudyNodeSolvesCaptcha(t *testing.T) {
+	srv, driver, study := newStudy(t, 20)
+	srv.RequireCaptcha(100, 2)
+
+	if err := driver.StudyNode(context.Background(), study); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests("/service/code/aa"); n != 2 {
+		t.Errorf("获取验证码 %d 次, 期望 2", n)
+	}
+}
+
+func TestStudyNodeGivesUpOnCaptcha(t *testing.T) {
+	srv, driver, study := newStudy(t, 20)
+	srv.RequireCaptcha(100, 1)
+	driver.Solver = func(ctx context.Context, image []byte) (string, error) {
+		return "", errors.New("无法识别")
+	}
+
+	err := driver.StudyNode(context.Background(), study)
+	if !errors.Is(err, platform.ErrCaptchaRequired) {
+		t.Fatalf("错误 = %v, 期望 ErrCaptchaRequired", err)
+	}
+	if n := srv.Requests("/service/code/aa"); n != yinghua.DefaultMaxCaptcha {
+		t.Errorf("获取验证码 %d 次, 期望 %d", n, yinghua.DefaultMaxCaptcha)
+	}
+}
+
+func TestStudyNodeTimeout(t *testing.T) {
+	_, driver, study := newStudy(t, 3600)
+	driver.NodeTimeout = 20 * time.Millisecond
+
+	err := driver.StudyNode(context.Background(), study)
+	if err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Fatalf("错误 = %v, 期望超时", err)
+	}
+}
+
+func TestStudyNodeCancel(t *testing.T) {
+	_, driver, study := newStudy(t, 3600)
+	ctx, cancel := context.WithCancel(context.Background())
+	study.OnProgress = func(platform.NodeProgress, platform.Checkpoint) {
+		cancel()
+	}
+
+	err := driver.StudyNode(ctx, study)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误 = %v, 期望 context.Canceled", err)
+	}
+}
@@ -0,0 +1,22 @@
+package types
+
+// Outcome 返回接口的错误码、消息以及是否需要验证码, 各响应类型实现相同的方法
+func (r *LoginResponse) Outcome() (code int, msg string, needCode bool) {
+	return r.Code, r.Msg, false
+}
+
+func (r *CoursesResponse) Outcome() (code int, msg string, needCode bool) {
+	return r.Code, r.Msg, false
+}
+
+func (r *ChaptersResponse) Outcome() (code int, msg string, needCode bool) {
+	return r.Code, r.Msg, false
+}
+
+func (r *NodeVideoResponse) Outcome() (code int, msg string, needCode bool) {
+	return r.Code, r.Msg, false
+}
+
+func (r *StudyNodeResponse) Outcome() (code int, msg string, needCode bool) {
+	return r.Code, r.Msg, r.NeedCode
+}
@@ -2,24 +2,59 @@ package yinghua
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	browser "github.com/EDDYCJY/fake-useragent"
 	"github.com/aoaostar/mooc/pkg/config"
+	"github.com/aoaostar/mooc/pkg/platform"
 	"github.com/aoaostar/mooc/pkg/util"
 	"github.com/aoaostar/mooc/pkg/yinghua/types"
 	"github.com/go-resty/resty/v2"
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultInterval 默认的学习时长上报与进度查询间隔
+const DefaultInterval = 10 * time.Second
+
+// CaptchaSolver 识别验证码图片
+type CaptchaSolver func(ctx context.Context, image []byte) (string, error)
+
+// YingHua 英华学堂平台驱动
 type YingHua struct {
-	User    config.User
-	Courses []types.CoursesList
-	client  *resty.Client
+	User config.User
+	// Interval 学习时长上报与进度查询间隔
+	Interval time.Duration
+	// Solver 验证码识别, 为空时使用 RecognizeCaptcha
+	Solver CaptchaSolver
+	// MaxRelogin 登录失效后最多重新登录的次数
+	MaxRelogin int
+	// ReloginBackoff 重新登录失败后的首次等待时间, 之后每次翻倍
+	ReloginBackoff time.Duration
+	// MaxRetries 学习节点时网络或平台错误连续重试的次数
+	MaxRetries int
+	// MaxCaptcha 学习单个节点时最多识别验证码的次数
+	MaxCaptcha int
+	// NodeTimeout 学习单个节点的最长时间, 为0时根据视频时长计算
+	NodeTimeout time.Duration
+	client      *resty.Client
+
+	loginMu sync.Mutex
+	tokenMu sync.RWMutex
+	session string
+}
+
+var _ platform.Driver = (*YingHua)(nil)
+
+func init() {
+	platform.Register("yinghua", func(user config.User) platform.Driver {
+		return New(user)
+	})
 }
 
 func New(user config.User) *YingHua {
@@ -35,17 +70,32 @@ func New(user config.User) *YingHua {
 	client.SetBaseURL(baseURL)
 	client.SetRetryCount(3)
 	client.SetHeader("user-agent", browser.Mobile())
-	return &YingHua{
-		User:   user,
-		client: client,
+	i := &YingHua{
+		User:           user,
+		Interval:       DefaultInterval,
+		Solver:         RecognizeCaptcha,
+		MaxRelogin:     DefaultMaxRelogin,
+		ReloginBackoff: DefaultReloginBackoff,
+		MaxRetries:     DefaultMaxRetries,
+		MaxCaptcha:     DefaultMaxCaptcha,
+		client:         client,
 	}
+	client.OnBeforeRequest(i.injectToken)
+	return i
+
+}
 
+// Login 登录平台, 之后的请求自动附带登录令牌
+func (i *YingHua) Login(ctx context.Context) error {
+	i.loginMu.Lock()
+	defer i.loginMu.Unlock()
+	return i.login(ctx)
 }
 
-func (i *YingHua) Login() error {
+func (i *YingHua) login(ctx context.Context) error {
 
 	resp := new(types.LoginResponse)
-	resp2, err := i.client.R().SetFormData(map[string]string{
+	resp2, err := i.client.R().SetContext(ctx).SetFormData(map[string]string{
 		"platform":  "Android",
 		"username":  i.User.Username,
 		"password":  i.User.Password,
@@ -60,227 +110,227 @@ func (i *YingHua) Login() error {
 	if err != nil {
 		return err
 	}
+	if err := checkStatus(resp2); err != nil {
+		return err
+	}
 	if resp.Code != 0 {
-		return errors.New(resp.Msg)
+		return classify(resp.Code, resp.Msg, false, true)
 	}
 
 	i.client.SetCookies(resp2.Cookies())
-
-	i.client.OnBeforeRequest(func(c *resty.Client, req *resty.Request) error {
-		req.FormData.Set("token", resp.Result.Data.Token)
-		return nil
-	})
-
+	i.setToken(resp.Result.Data.Token)
 	return nil
 
 }
 
-func (i *YingHua) GetCourses() error {
+// ListCourses 获取在学课程
+func (i *YingHua) ListCourses(ctx context.Context) ([]platform.Course, error) {
 
 	resp := new(types.CoursesResponse)
-	_, err := i.client.R().
-		SetResult(resp).
-		Post("/api/course.json")
-
-	if err != nil {
-		return err
-	}
-
-	if resp.Code != 0 {
-		return errors.New(resp.Msg)
-	}
-	i.Courses = resp.Result.List
-	return nil
-}
-
-// GetCourseByName 根据课程名称查找课程（模糊匹配）
-func (i *YingHua) GetCourseByName(name string) ([]types.CoursesList, error) {
-	if len(i.Courses) == 0 {
-		if err := i.GetCourses(); err != nil {
-			return nil, err
-		}
+	if err := i.post(ctx, "/api/course.json", nil, resp); err != nil {
+		return nil, err
 	}
 
-	var result []types.CoursesList
-	for _, course := range i.Courses {
-		if strings.Contains(strings.ToLower(course.Name), strings.ToLower(name)) {
-			result = append(result, course)
-		}
+	courses := make([]platform.Course, 0, len(resp.Result.List))
+	for _, course := range resp.Result.List {
+		courses = append(courses, platform.Course{
+			ID:           course.ID,
+			Name:         course.Name,
+			Progress:     float64(course.Progress),
+			ProgressText: course.Progress1,
+			Ended:        course.State == 2,
+			StartDate:    course.StartDate,
+			EndDate:      course.EndDate,
+			StartAt:      parseDate(course.StartDate, false),
+			EndAt:        parseDate(course.EndDate, true),
+		})
 	}
-
-	return result, nil
+	return courses, nil
 }
 
-func (i *YingHua) GetChapters(course types.CoursesList) ([]types.ChaptersList, error) {
+// ListChapters 获取课程的章节与节点
+func (i *YingHua) ListChapters(ctx context.Context, course platform.Course) ([]platform.Chapter, error) {
 
 	resp := new(types.ChaptersResponse)
-	_, err := i.client.R().
-		SetResult(resp).
-		SetFormData(map[string]string{
-			"courseId": strconv.Itoa(course.ID),
-		}).
-		Post("/api/course/chapter.json")
-
+	err := i.post(ctx, "/api/course/chapter.json", map[string]string{
+		"courseId": strconv.Itoa(course.ID),
+	}, resp)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.Code != 0 {
-		return nil, errors.New(resp.Msg)
+	chapters := make([]platform.Chapter, 0, len(resp.Result.List))
+	for _, chapter := range resp.Result.List {
+		c := platform.Chapter{
+			ID:    chapter.ID,
+			Name:  chapter.Name,
+			Index: chapter.Idx,
+		}
+		for _, node := range chapter.NodeList {
+			c.Nodes = append(c.Nodes, platform.Node{
+				ID:       node.ID,
+				Name:     node.Name,
+				Index:    node.Idx,
+				Video:    node.TabVideo,
+				Types:    nodeTypes(node),
+				URL:      node.VoteURL,
+				Duration: parseDuration(node.VideoDuration),
+				Done:     node.VideoState == 2,
+				Locked:   node.NodeLock != 0,
+				UnlockAt: unlockTime(node.UnlockTimeStamp),
+			})
+		}
+		chapters = append(chapters, c)
 	}
-	return resp.Result.List, nil
+	return chapters, nil
 }
 
-func (i *YingHua) StudyCourse(course types.CoursesList) error {
-	i.Output(fmt.Sprintf("开始学习课程: [%s][courseId=%d]", course.Name, course.ID))
-	chapters, err := i.GetChapters(course)
+// NodeProgress 获取节点的学习进度
+func (i *YingHua) NodeProgress(ctx context.Context, node platform.Node) (platform.NodeProgress, error) {
+
+	var resp = new(types.NodeVideoResponse)
+	err := i.post(ctx, "/api/node/video.json", map[string]string{
+		"nodeId": strconv.Itoa(node.ID),
+	}, resp)
 	if err != nil {
-		i.OutputWith(fmt.Sprintf("获取课程章节失败: %s", err.Error()), logrus.Errorf)
-		return err
+		return platform.NodeProgress{}, err
 	}
-	for _, chapter := range chapters {
-		i.StudyChapter(chapter, course.Name)
-	}
-
-	i.Output(fmt.Sprintf("课程学习完成: [%s][courseId=%d]", course.Name, course.ID))
-	return nil
-}
-
-func (i *YingHua) StudyChapter(chapter types.ChaptersList, courseName string) {
 
-	i.Output(fmt.Sprintf("课程: [%s] 当前第 %d 章, [%s][chapterId=%d]", courseName, chapter.Idx, chapter.Name, chapter.ID))
-	for _, node := range chapter.NodeList {
-		// 试题跳过
-		if node.TabVideo {
-			i.StudyNode(node, courseName, chapter.Name)
+	data := resp.Result.Data
+	progress := platform.NodeProgress{
+		Duration: data.VideoDuration,
+		Done:     data.StudyTotal.State == "2",
+	}
+	if data.StudyTotal.Progress != "" {
+		value, err := strconv.ParseFloat(data.StudyTotal.Progress, 64)
+		if err != nil {
+			return progress, fmt.Errorf("无效的进度: %s", data.StudyTotal.Progress)
 		}
+		progress.Percent = value * 100
 	}
-
+	return progress, nil
 }
 
-func (i *YingHua) StudyNode(node types.ChaptersNodeList, courseName string, chapterName string) {
-startStudy:
-	i.Output(fmt.Sprintf("课程: [%s] 章节: [%s] 当前第 %d 课, [%s][nodeId=%d]", courseName, chapterName, node.Idx, node.Name, node.ID))
-	var studyTime = 1
-	var studyId = 0
-	var nodeProgress = types.NodeVideoData{
-		StudyTotal: types.NodeVideoStudyTotal{
-			Progress: "0.00",
-		},
+// nodeTypes 根据节点的标签识别内容类型, 没有任何标签时为 NodeUnknown
+func nodeTypes(node types.ChaptersNodeList) []platform.NodeType {
+	var result []platform.NodeType
+	tabs := []struct {
+		enabled bool
+		kind    platform.NodeType
+	}{
+		{node.TabVideo, platform.NodeVideo},
+		{node.TabFile, platform.NodeFile},
+		{node.TabVote, platform.NodeVote},
+		{node.TabWork, platform.NodeWork},
+		{node.TabExam, platform.NodeExam},
 	}
-	var flag = true
-	go func() {
-		for flag {
-			var err error
-			nodeProgress, err = i.GetNodeProgress(node)
-			if err != nil {
-				i.OutputWith(fmt.Sprintf("课程: [%s] 章节: [%s] %s[nodeId=%d], %s[studyId=%d]", courseName, chapterName, node.Name, node.ID, err.Error(), studyId), logrus.Errorf)
-				flag = false
-				break
-			}
-			if nodeProgress.StudyTotal.State == "2" {
-				node.VideoState = 2
-				break
-			}
-			time.Sleep(time.Second * 10)
+	for _, tab := range tabs {
+		if tab.enabled {
+			result = append(result, tab.kind)
 		}
-	}()
+	}
+	if len(result) == 0 {
+		result = append(result, platform.NodeUnknown)
+	}
+	return result
+}
 
-	for node.VideoState != 2 {
-		if !flag {
-			goto startStudy
-		}
+// dateLayouts 课程日期可能的格式
+var dateLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "2006/01/02"}
 
-		var formData = map[string]string{
-			"nodeId":    strconv.Itoa(node.ID),
-			"studyTime": strconv.Itoa(studyTime),
-			"studyId":   strconv.Itoa(studyId),
-		}
-	captcha:
-		var resp = new(types.StudyNodeResponse)
-		_, err := i.client.R().
-			SetFormData(formData).
-			SetResult(resp).
-			Post("/api/node/study.json")
+// parseDate 解析课程日期, 无法解析时返回零值
+// 结课日期只有日期时视为当天结束, 即次日零点
+func parseDate(value string, end bool) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
 		if err != nil {
-			i.OutputWith(fmt.Sprintf("%s[nodeId=%d], %s[studyId=%d][studyTime=%d]", node.Name, node.ID, err.Error(), studyId, studyTime), logrus.Errorf)
 			continue
 		}
-		if resp.Code != 0 {
-			i.OutputWith(fmt.Sprintf("课程: [%s] 章节: [%s] %s[nodeId=%d], %s[studyId=%d][studyTime=%d]", courseName, chapterName, node.Name, node.ID, resp.Msg, studyId, studyTime), logrus.Errorf)
-			if resp.NeedCode {
-				formData["code"] = i.FuckCaptcha() + "_"
-				goto captcha
-			}
-			flag = false
-			break
-		}
-		studyId = resp.Result.Data.StudyID
-		if nodeProgress.StudyTotal.Progress == "" {
-			nodeProgress.StudyTotal.Progress = "0.00"
-
+		if end && !strings.Contains(layout, ":") {
+			t = t.AddDate(0, 0, 1)
 		}
-		parseFloat, err := strconv.ParseFloat(nodeProgress.StudyTotal.Progress, 64)
-
-		if err != nil {
-			i.OutputWith(fmt.Sprintf("课程: [%s] 章节: [%s] %s[nodeId=%d], %s[studyId=%d]", courseName, chapterName, node.Name, node.ID, err.Error(), studyId), logrus.Errorf)
-			continue
-		}
-		i.Output(fmt.Sprintf("课程: [%s] 章节: [%s] %s[nodeId=%d], %s[studyId=%d], 当前进度: %.f%%", courseName, chapterName, node.Name, node.ID, resp.Msg, studyId, parseFloat*100))
-		studyTime += 10
-		time.Sleep(time.Second * 10)
+		return t
 	}
+	return time.Time{}
 }
 
-func (i *YingHua) GetNodeProgress(node types.ChaptersNodeList) (types.NodeVideoData, error) {
+// unlockTime 将解锁时间戳转换为时间, 没有时间戳时返回零值
+func unlockTime(timestamp int) time.Time {
+	if timestamp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(timestamp), 0)
+}
 
-	var resp = new(types.NodeVideoResponse)
-	_, err := i.client.R().
-		SetFormData(map[string]string{
-			"nodeId": strconv.Itoa(node.ID),
-		}).
-		SetResult(resp).
-		Post("/api/node/video.json")
-	if err != nil {
-		i.OutputWith(fmt.Sprintf("%s[nodeId=%d], %s", node.Name, node.ID, err.Error()), logrus.Errorf)
-		return resp.Result.Data, nil
+// parseDuration 解析 "hh:mm:ss"、"mm:ss" 或秒数形式的时长, 无法解析时返回0
+func parseDuration(value string) int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
 	}
-	if resp.Code != 0 {
-		return resp.Result.Data, errors.New(resp.Msg)
+	seconds := 0
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + int(n)
 	}
-	return resp.Result.Data, nil
+	return seconds
 }
 
-func (i *YingHua) FuckCaptcha() string {
+// FuckCaptcha 获取并识别验证码, 识别失败时返回空字符串
+func (i *YingHua) FuckCaptcha(ctx context.Context) string {
 
 	i.Output("正在识别验证码")
 	response, err := i.client.R().
+		SetContext(ctx).
 		Get(fmt.Sprintf("/service/code/aa?t=%d", time.Now().UnixNano()))
 
 	if err != nil {
 		i.OutputWith(err.Error(), logrus.Errorf)
+		return ""
+	}
+	solver := i.Solver
+	if solver == nil {
+		solver = RecognizeCaptcha
+	}
+	s, err := solver(ctx, response.Body())
+	if err != nil {
+		i.OutputWith(err.Error(), logrus.Errorf)
+		return ""
 	}
+	i.Output(fmt.Sprintf("验证码识别成功: %s", s))
+	return s
+}
+
+// RecognizeCaptcha 使用在线接口识别验证码图片
+func RecognizeCaptcha(ctx context.Context, image []byte) (string, error) {
 	var resp = new(types.Captcha)
-	client := resty.New()
-	_, err = client.R().
-		SetFileReader("file", "image.png", bytes.NewReader(response.Body())).
+	_, err := resty.New().R().
+		SetContext(ctx).
+		SetFileReader("file", "image.png", bytes.NewReader(image)).
 		SetResult(resp).
 		Post("https://api.opop.vip/captcha/recognize")
 
 	if err != nil {
-		i.OutputWith(err.Error(), logrus.Errorf)
+		return "", err
 	}
 	if resp.Status != "ok" {
-		i.OutputWith(resp.Message, logrus.Errorf)
+		return "", errors.New("验证码识别失败: " + resp.Message)
 	}
-	s := resp.Data.(string)
-	i.Output(fmt.Sprintf("验证码识别成功: %s", s))
-	return s
+	s, ok := resp.Data.(string)
+	if !ok {
+		return "", errors.New("验证码识别失败: 无效的识别结果")
+	}
+	return s, nil
 }
+
 func (i *YingHua) Output(message string) {
 	i.OutputWith(message, logrus.Infof)
 }
 
 func (i *YingHua) OutputWith(message string, writer func(format string, args ...interface{})) {
-	writer("[协程ID=%d][%s] %s", util.GetGid(), i.User.Username, message)
+	util.Output(i.User.Username, message, writer)
 }
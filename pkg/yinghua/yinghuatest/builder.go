@@ -0,0 +1,55 @@
+package yinghuatest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/yinghua/types"
+)
+
+// Course 构造进行中的课程
+func Course(id int, name string) types.CoursesList {
+	return types.CoursesList{
+		ID:        id,
+		Name:      name,
+		Progress1: "0%",
+		State:     1,
+		TabVideo:  true,
+	}
+}
+
+// Chapter 构造章节, 节点序号按顺序生成
+func Chapter(id int, name string, nodes ...types.ChaptersNodeList) types.ChaptersList {
+	for i := range nodes {
+		nodes[i].Idx = i + 1
+	}
+	return types.ChaptersList{ID: id, Name: name, NodeList: nodes}
+}
+
+// VideoNode 构造视频节点, duration 为视频时长, 单位秒
+func VideoNode(id int, name string, duration int) types.ChaptersNodeList {
+	return types.ChaptersNodeList{
+		ID:            id,
+		Name:          name,
+		TabVideo:      true,
+		VideoDuration: fmt.Sprintf("%02d:%02d", duration/60, duration%60),
+	}
+}
+
+// WorkNode 构造作业节点
+func WorkNode(id int, name string) types.ChaptersNodeList {
+	return types.ChaptersNodeList{ID: id, Name: name, TabWork: true}
+}
+
+// VoteNode 构造投票节点
+func VoteNode(id int, name string, url string) types.ChaptersNodeList {
+	return types.ChaptersNodeList{ID: id, Name: name, TabVote: true, VoteURL: url}
+}
+
+// Lock 锁定节点直到 until, 到达解锁时间后模拟服务自动解锁
+func Lock(node types.ChaptersNodeList, until time.Time) types.ChaptersNodeList {
+	node.NodeLock = 1
+	node.UnlockTimeStamp = int(until.Unix())
+	node.UnlockTime = until.Format("2006-01-02 15:04:05")
+	return node
+}
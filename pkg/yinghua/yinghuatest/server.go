@@ -0,0 +1,426 @@
+// Package yinghuatest 提供模拟英华学堂接口的本地服务, 用于不依赖真实平台的测试
+package yinghuatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aoaostar/mooc/pkg/yinghua/types"
+)
+
+// Server 模拟英华学堂接口, 状态可在测试中随时修改, 所有方法并发安全
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	users    map[string]string
+	tokens   map[string]string
+	seq      int
+	courses  []types.CoursesList
+	chapters map[int][]types.ChaptersList
+	nodes    map[int]*node
+	failures map[string][]Failure
+	requests map[string]int
+	// studying 用户正在处理中的上报学时请求数, peaks 为其峰值
+	studying map[string]int
+	peaks    map[string]int
+	// studyDelay 上报学时请求的处理耗时
+	studyDelay time.Duration
+}
+
+// node 视频节点的学习状态
+type node struct {
+	duration int
+	studied  int
+	studyID  int
+	// requests 获取视频信息与上报学时的请求次数
+	requests int
+	// captcha 剩余需要验证码的次数
+	captcha int
+	// unlockAt 节点的解锁时间, 零值表示未锁定
+	unlockAt time.Time
+}
+
+// Failure 预设的接口错误响应
+type Failure struct {
+	Code     int
+	Msg      string
+	NeedCode bool
+	// Status 非0时直接返回该 HTTP 状态码
+	Status int
+}
+
+// NewServer 启动模拟服务, 测试结束时需调用 Close
+func NewServer() *Server {
+	s := &Server{
+		users:    make(map[string]string),
+		tokens:   make(map[string]string),
+		chapters: make(map[int][]types.ChaptersList),
+		nodes:    make(map[int]*node),
+		failures: make(map[string][]Failure),
+		requests: make(map[string]int),
+		studying: make(map[string]int),
+		peaks:    make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/login.json", s.handleLogin)
+	mux.HandleFunc("/api/course.json", s.authorized(s.handleCourses))
+	mux.HandleFunc("/api/course/chapter.json", s.authorized(s.handleChapters))
+	mux.HandleFunc("/api/node/video.json", s.authorized(s.handleVideo))
+	mux.HandleFunc("/api/node/study.json", s.authorized(s.handleStudy))
+	mux.HandleFunc("/service/code/aa", s.handleCaptcha)
+	s.Server = httptest.NewServer(s.count(mux))
+	return s
+}
+
+// AddUser 添加可登录的用户
+func (s *Server) AddUser(username string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = password
+}
+
+// AddCourse 添加课程及其章节, 所有用户共享相同的课程
+func (s *Server) AddCourse(course types.CoursesList, chapters ...types.ChaptersList) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.courses = append(s.courses, course)
+	s.chapters[course.ID] = chapters
+	for _, chapter := range chapters {
+		for _, n := range chapter.NodeList {
+			if !n.TabVideo {
+				continue
+			}
+			state := &node{duration: parseDuration(n.VideoDuration)}
+			if n.VideoState == 2 {
+				state.studied = state.duration
+			}
+			if n.NodeLock != 0 {
+				state.unlockAt = time.Unix(int64(n.UnlockTimeStamp), 0)
+			}
+			s.nodes[n.ID] = state
+		}
+	}
+}
+
+// Fail 预设接口接下来的错误响应, 按顺序每次请求消耗一个
+// path 为接口路径, 如 /api/node/study.json
+func (s *Server) Fail(path string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = append(s.failures[path], failures...)
+}
+
+// RequireCaptcha 节点接下来 times 次上报学习时长需要验证码, 提交验证码后才计入
+func (s *Server) RequireCaptcha(nodeID int, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.nodes[nodeID]; ok {
+		n.captcha = times
+	}
+}
+
+// ExpireTokens 使所有已登录的令牌失效
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]string)
+}
+
+// DelayStudy 每次上报学时请求在返回前等待 delay, 使并发的请求在服务端重叠
+func (s *Server) DelayStudy(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.studyDelay = delay
+}
+
+// PeakStudies 获取用户同时处理中的上报学时请求数的峰值
+func (s *Server) PeakStudies(username string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peaks[username]
+}
+
+// Progress 获取节点的学习进度 0-1
+func (s *Server) Progress(nodeID int) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.nodes[nodeID]
+	if !ok {
+		return 0
+	}
+	return n.progress()
+}
+
+// Requests 获取接口的请求次数
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// NodeRequests 获取节点的视频信息与上报学时请求次数
+func (s *Server) NodeRequests(nodeID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.nodes[nodeID]; ok {
+		return n.requests
+	}
+	return 0
+}
+
+// StudyOrder 按首次上报学时的先后顺序返回节点ID
+func (s *Server) StudyOrder() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int
+	for id, n := range s.nodes {
+		if n.studyID > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return s.nodes[ids[i]].studyID < s.nodes[ids[j]].studyID })
+	return ids
+}
+
+func (n *node) progress() float64 {
+	if n.duration <= 0 || n.studied >= n.duration {
+		return 1
+	}
+	return float64(n.studied) / float64(n.duration)
+}
+
+func (n *node) done() bool {
+	return n.progress() >= 1
+}
+
+func (n *node) locked() bool {
+	return !n.unlockAt.IsZero() && time.Now().Before(n.unlockAt)
+}
+
+// count 统计请求次数
+func (s *Server) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		s.mu.Lock()
+		s.requests[request.URL.Path]++
+		s.mu.Unlock()
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// authorized 校验令牌并返回预设的错误响应
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if s.fail(writer, request.URL.Path) {
+			return
+		}
+		s.mu.Lock()
+		_, ok := s.tokens[request.FormValue("token")]
+		s.mu.Unlock()
+		if !ok {
+			writeJSON(writer, map[string]interface{}{"_code": 1, "status": false, "msg": "请先登录"})
+			return
+		}
+		next(writer, request)
+	}
+}
+
+// fail 存在预设错误时写入错误响应
+func (s *Server) fail(writer http.ResponseWriter, path string) bool {
+	s.mu.Lock()
+	queue := s.failures[path]
+	if len(queue) == 0 {
+		s.mu.Unlock()
+		return false
+	}
+	failure := queue[0]
+	s.failures[path] = queue[1:]
+	s.mu.Unlock()
+
+	if failure.Status != 0 {
+		http.Error(writer, http.StatusText(failure.Status), failure.Status)
+		return true
+	}
+	writeJSON(writer, map[string]interface{}{
+		"_code":     failure.Code,
+		"status":    false,
+		"msg":       failure.Msg,
+		"need_code": failure.NeedCode,
+	})
+	return true
+}
+
+func (s *Server) handleLogin(writer http.ResponseWriter, request *http.Request) {
+	if s.fail(writer, request.URL.Path) {
+		return
+	}
+	username, password := request.FormValue("username"), request.FormValue("password")
+
+	s.mu.Lock()
+	expected, ok := s.users[username]
+	if !ok || expected != password {
+		s.mu.Unlock()
+		writeJSON(writer, types.LoginResponse{Code: 1, Msg: "用户名或密码错误"})
+		return
+	}
+	s.seq++
+	token := fmt.Sprintf("token-%d", s.seq)
+	s.tokens[token] = username
+	s.mu.Unlock()
+
+	resp := types.LoginResponse{Status: true, Msg: "登录成功"}
+	resp.Result.Data.Token = token
+	writeJSON(writer, resp)
+}
+
+func (s *Server) handleCourses(writer http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := types.CoursesResponse{Status: true}
+	resp.Result.List = append([]types.CoursesList{}, s.courses...)
+	writeJSON(writer, resp)
+}
+
+func (s *Server) handleChapters(writer http.ResponseWriter, request *http.Request) {
+	courseID, _ := strconv.Atoi(request.FormValue("courseId"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chapters, ok := s.chapters[courseID]
+	if !ok {
+		writeJSON(writer, types.ChaptersResponse{Code: 1, Msg: "课程不存在"})
+		return
+	}
+
+	// 返回当前的学习状态
+	resp := types.ChaptersResponse{Status: true}
+	for _, chapter := range chapters {
+		chapter.NodeList = append([]types.ChaptersNodeList{}, chapter.NodeList...)
+		for i, n := range chapter.NodeList {
+			state, ok := s.nodes[n.ID]
+			if !ok {
+				continue
+			}
+			if state.done() {
+				chapter.NodeList[i].VideoState = 2
+			}
+			if !state.locked() {
+				chapter.NodeList[i].NodeLock = 0
+			}
+		}
+		resp.Result.List = append(resp.Result.List, chapter)
+	}
+	writeJSON(writer, resp)
+}
+
+func (s *Server) handleVideo(writer http.ResponseWriter, request *http.Request) {
+	nodeID, _ := strconv.Atoi(request.FormValue("nodeId"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.nodes[nodeID]
+	if !ok {
+		writeJSON(writer, types.NodeVideoResponse{Code: 1, Msg: "节点不存在"})
+		return
+	}
+	n.requests++
+
+	resp := types.NodeVideoResponse{Status: true}
+	resp.Result.Data.VideoDuration = n.duration
+	resp.Result.Data.StudyTotal.Duration = strconv.Itoa(n.studied)
+	resp.Result.Data.StudyTotal.Progress = strconv.FormatFloat(n.progress(), 'f', 2, 64)
+	resp.Result.Data.StudyTotal.State = "1"
+	if n.done() {
+		resp.Result.Data.StudyTotal.State = "2"
+	}
+	writeJSON(writer, resp)
+}
+
+// handleStudy 上报学习时长, 节点已学习时长按 studyTime 推进
+func (s *Server) handleStudy(writer http.ResponseWriter, request *http.Request) {
+	nodeID, _ := strconv.Atoi(request.FormValue("nodeId"))
+	studyTime, _ := strconv.Atoi(request.FormValue("studyTime"))
+	username := s.begin(request.FormValue("token"))
+	defer s.end(username)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.nodes[nodeID]
+	if !ok {
+		writeJSON(writer, types.StudyNodeResponse{Code: 1, Msg: "节点不存在"})
+		return
+	}
+	n.requests++
+	if n.locked() {
+		writeJSON(writer, types.StudyNodeResponse{Code: 1, Msg: "节点尚未解锁"})
+		return
+	}
+	if n.captcha > 0 {
+		if request.FormValue("code") == "" {
+			writeJSON(writer, types.StudyNodeResponse{Code: 1, NeedCode: true, Msg: "请输入验证码"})
+			return
+		}
+		n.captcha--
+	}
+
+	if n.studyID == 0 {
+		s.seq++
+		n.studyID = s.seq
+	}
+	if studyTime > n.studied {
+		n.studied = studyTime
+	}
+	resp := types.StudyNodeResponse{Status: true, Msg: "提交学时成功"}
+	resp.Result.Data.StudyID = n.studyID
+	writeJSON(writer, resp)
+}
+
+// begin 记录用户处理中的上报学时请求并等待预设的处理耗时
+func (s *Server) begin(token string) string {
+	s.mu.Lock()
+	username := s.tokens[token]
+	s.studying[username]++
+	if s.studying[username] > s.peaks[username] {
+		s.peaks[username] = s.studying[username]
+	}
+	delay := s.studyDelay
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+	return username
+}
+
+// end 上报学时请求处理完成
+func (s *Server) end(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.studying[username]--
+}
+
+func (s *Server) handleCaptcha(writer http.ResponseWriter, _ *http.Request) {
+	writer.Header().Set("Content-Type", "image/png")
+	_, _ = writer.Write([]byte("captcha"))
+}
+
+func writeJSON(writer http.ResponseWriter, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(body)
+}
+
+// parseDuration 解析 "mm:ss" 或秒数形式的时长
+func parseDuration(value string) int {
+	seconds := 0
+	for _, part := range strings.Split(value, ":") {
+		n, _ := strconv.Atoi(strings.TrimSpace(part))
+		seconds = seconds*60 + n
+	}
+	return seconds
+}